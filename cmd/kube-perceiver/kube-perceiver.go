@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"time"
 
 	api "bitbucket.org/bdsengineering/perceptor/pkg/api"
 	clustermanager "bitbucket.org/bdsengineering/perceptor/pkg/clustermanager"
+	perceiver "bitbucket.org/bdsengineering/perceptor/pkg/perceiver"
+	perceptorclient "bitbucket.org/bdsengineering/perceptor/pkg/perceptorclient"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,159 +24,174 @@ import (
 // number of successes, failures, of each perceptor endpoint
 // ??? number of scan results fetched from perceptor
 
+const perceptorClientWorkers = 4
+
 func main() {
-	log.Info("started")
+	if len(os.Args) > 1 && os.Args[1] == "play" {
+		runPlay(os.Args[2:])
+		return
+	}
+	runPerceiver()
+}
 
+// runPlay is the "kube play" subcommand: it decodes the Kubernetes
+// manifest at each given path and submits the pods it describes straight
+// to perceptor for scanning, without any of it needing to be deployed.
+// This is meant to run from a CI pipeline, so it POSTs synchronously and
+// exits non-zero on the first failure rather than queueing and retrying.
+func runPlay(paths []string) {
+	if len(paths) == 0 {
+		log.Error("play: expected at least one manifest path")
+		os.Exit(1)
+	}
 	podURL := fmt.Sprintf("%s:%s/%s", api.PerceptorBaseURL, api.PerceptorPort, api.PodPath)
-	allPodsURL := fmt.Sprintf("%s:%s/%s", api.PerceptorBaseURL, api.PerceptorPort, api.AllPodsPath)
-	scanResultsURL := fmt.Sprintf("%s:%s/%s", api.PerceptorBaseURL, api.PerceptorPort, api.ScanResultsPath)
+
+	for _, path := range paths {
+		manifest, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Errorf("play: unable to read %s: %s", path, err.Error())
+			os.Exit(1)
+		}
+		pods, err := clustermanager.PodsFromManifest(manifest)
+		if err != nil {
+			log.Errorf("play: unable to decode %s: %s", path, err.Error())
+			os.Exit(1)
+		}
+		for _, pod := range pods {
+			jsonBytes, err := json.Marshal(pod)
+			if err != nil {
+				log.Errorf("play: unable to serialize pod %s: %s", pod.QualifiedName(), err.Error())
+				os.Exit(1)
+			}
+			resp, err := http.Post(podURL, "application/json", bytes.NewBuffer(jsonBytes))
+			if err != nil {
+				log.Errorf("play: unable to POST pod %s to %s: %s", pod.QualifiedName(), podURL, err.Error())
+				os.Exit(1)
+			}
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				log.Errorf("play: %s rejected pod %s with status %d", podURL, pod.QualifiedName(), resp.StatusCode)
+				os.Exit(1)
+			}
+			log.Infof("play: submitted %s from %s for scanning", pod.QualifiedName(), path)
+		}
+	}
+}
+
+func runPerceiver() {
+	// bus carries perceiver's activity to both logrus and the /events
+	// endpoint -- it's a separate, much simpler stream from pkg/core's,
+	// which carries core's domain events (pods, images, scans) instead of
+	// perceiver's own operational log.
+	bus := perceiver.NewEventBus()
+	bus.Infof("started")
+
+	perceptorBaseURL := fmt.Sprintf("%s:%s", api.PerceptorBaseURL, api.PerceptorPort)
 
 	// 1. get kube client
 	clusterClient, err := clustermanager.NewKubeClientFromCluster()
 	if err != nil {
-		log.Errorf("unable to instantiate kube client: %s", err.Error())
+		bus.Errorf("unable to instantiate kube client: %s", err.Error())
+		panic(err)
+	}
+
+	// 2. a retrying, queueing client for talking to perceptor. Every
+	//    call below just enqueues a typed request and returns -- perceptor
+	//    being briefly slow or unavailable never blocks the caller.
+	perceptorClient := perceptorclient.NewClient(perceptorBaseURL, perceptorClientWorkers)
+	defer perceptorClient.Stop()
+
+	// 3. watch pods with a DeltaFIFO-backed reflector and forward the
+	//    resulting events into perceptor. Each time the reflector relists,
+	//    it emits a Sync delta (delivered on the same channel as PodAdd) for
+	//    every pod it lists, in place of the separate "PUT all pods every 20
+	//    seconds" loop -- that loop is gone now.
+	reflector, err := clustermanager.NewPodReflector(30 * time.Second)
+	if err != nil {
+		bus.Errorf("unable to instantiate pod reflector: %s", err.Error())
 		panic(err)
 	}
+	stopCh := make(chan struct{})
+	go reflector.Run(stopCh)
 
-	// 2. send events from kube client into perceptor
 	go func() {
 		for {
 			select {
-			case addPod := <-clusterClient.PodAdd():
-				log.Infof("cluster manager event -- add pod: UID %s, name %s", addPod.New.UID, addPod.New.QualifiedName())
-				jsonBytes, err := json.Marshal(addPod.New)
-				if err != nil {
-					log.Errorf("unable to serialize pod: %s", err.Error())
-					panic(err)
-				}
-				resp, err := http.Post(podURL, "application/json", bytes.NewBuffer(jsonBytes))
-				if err != nil {
-					log.Errorf("unable to POST to %s: %s", podURL, err.Error())
-					continue
-				}
-				defer resp.Body.Close()
-				if err == nil && resp.StatusCode == 200 {
-					log.Infof("http POST request to %s succeeded", podURL)
-				} else {
-					log.Errorf("http POST request to %s failed: %s", podURL, err.Error())
-				}
-			case updatePod := <-clusterClient.PodUpdate():
-				log.Infof("cluster manager event -- update pod: UID %s, name %s", updatePod.New.UID, updatePod.New.QualifiedName())
-				jsonBytes, err := json.Marshal(updatePod.New)
-				if err != nil {
-					log.Errorf("unable to serialize pod: %s", err.Error())
-					panic(err)
-				}
-				req, err := http.NewRequest("PUT", podURL, bytes.NewBuffer(jsonBytes))
-				if err != nil {
-					log.Errorf("unable to create PUT request for %s: %s", podURL, err.Error())
-					panic(err)
-				}
-				req.Header.Set("Content-Type", "application/json")
-				resp, err := http.DefaultClient.Do(req)
-				if err != nil {
-					log.Errorf("unable to PUT to %s: %s", podURL, err.Error())
-					continue
-				}
-				defer resp.Body.Close()
-				if err == nil && resp.StatusCode == 200 {
-					log.Infof("http PUT request to %s succeeded", podURL)
-				} else {
-					log.Errorf("http PUT request to %s failed: %s", podURL, err.Error())
-				}
-			case deletePod := <-clusterClient.PodDelete():
-				log.Infof("cluster manager event -- delete pod: qualified name %s", deletePod.QualifiedName)
-				jsonBytes, err := json.Marshal(deletePod)
-				if err != nil {
-					log.Errorf("unable to serialize pod: %s", err.Error())
-					panic(err)
-				}
-				req, err := http.NewRequest("DELETE", podURL, bytes.NewBuffer(jsonBytes))
-				if err != nil {
-					log.Errorf("unable to create DELETE request for %s: %s", podURL, err.Error())
-					panic(err)
-				}
-				req.Header.Set("Content-Type", "application/json")
-				resp, err := http.DefaultClient.Do(req)
-				if err != nil {
-					log.Errorf("unable to DELETE to %s: %s", podURL, err.Error())
-					continue
-				}
-				defer resp.Body.Close()
-				if err == nil && resp.StatusCode == 200 {
-					log.Infof("http DELETE request to %s succeeded", podURL)
-				} else {
-					log.Errorf("http DELETE request to %s failed: %s", podURL, err.Error())
-				}
+			case addPod := <-reflector.PodAdd():
+				bus.Infof("cluster manager event -- add pod: UID %s, name %s", addPod.New.UID, addPod.New.QualifiedName())
+				perceptorClient.AddPod(addPod.New)
+			case updatePod := <-reflector.PodUpdate():
+				bus.Infof("cluster manager event -- update pod: UID %s, name %s", updatePod.New.UID, updatePod.New.QualifiedName())
+				perceptorClient.UpdatePod(updatePod.New)
+			case deletePod := <-reflector.PodDelete():
+				bus.Infof("cluster manager event -- delete pod: qualified name %s", deletePod.QualifiedName)
+				perceptorClient.DeletePod(deletePod.QualifiedName)
 			}
 		}
 	}()
 
-	// 3. poll perceptor for vulns, translating those into annotations which
-	//    get sent off to the kube apiserver
-	go func() {
-		for {
-			time.Sleep(20 * time.Second)
-			log.Infof("attempting to GET %s", scanResultsURL)
-			resp, err := http.Get(scanResultsURL)
-			if err != nil {
-				log.Errorf("unable to GET %s: %s", scanResultsURL, err.Error())
-				continue
-			}
-			defer resp.Body.Close()
-
-			bodyBytes, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				log.Errorf("unable to read resp body from %s: %s", scanResultsURL, err.Error())
-			}
-
-			var scanResults api.ScanResults
-			err = json.Unmarshal(bodyBytes, &scanResults)
-			if err == nil && resp.StatusCode == 200 {
-				log.Infof("GET to %s succeeded, about to update annotations", scanResultsURL)
-				for _, pod := range scanResults.Pods {
-					bdAnnotations := clustermanager.NewBlackDuckAnnotations(pod.PolicyViolations, pod.Vulnerabilities, pod.OverallStatus)
-					clusterClient.SetBlackDuckPodAnnotations(pod.Namespace, pod.Name, *bdAnnotations)
-				}
-			} else {
-				log.Errorf("unable to Unmarshal ScanResults from url %s: %s", scanResultsURL, err.Error())
+	// 4. accept a webhook callback from perceptor when a scan completes,
+	//    translating it straight into annotations on the apiserver. This
+	//    replaces polling ScanResultsPath every 20 seconds: perceptor's
+	//    hub.ScanMonitor now pushes results here the moment they're ready,
+	//    instead of every pod's annotations lagging by up to 20 seconds.
+	http.HandleFunc("/"+api.ScanCompleteWebhookPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "expected POST", http.StatusMethodNotAllowed)
+			return
+		}
+		bodyBytes, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		var scanResults api.ScanResults
+		if err := json.Unmarshal(bodyBytes, &scanResults); err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode scan results: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		for _, pod := range scanResults.Pods {
+			bdAnnotations := clustermanager.NewBlackDuckAnnotations(pod.PolicyViolations, pod.Vulnerabilities, pod.OverallStatus)
+			if err := clusterClient.SetBlackDuckPodAnnotations(pod.Namespace, pod.Name, *bdAnnotations); err != nil {
+				bus.Errorf("webhook: unable to set annotations on pod %s/%s: %s", pod.Namespace, pod.Name, err.Error())
 			}
 		}
-	}()
+		bus.Infof("webhook: updated annotations for %d pods", len(scanResults.Pods))
+		w.WriteHeader(http.StatusOK)
+	})
 
-	// 4. send over all pod information every <insert-time-period>.  This is a hack
-	//    for when perceptor misses events -- either because it started after perceiver,
-	//    or because it went down.
-	go func() {
-		duration := 20 * time.Second
-		for {
-			time.Sleep(duration)
-			pods, err := clusterClient.GetAllPods()
-			if err != nil {
-				log.Errorf("unable to get all pods: %s", err.Error())
-				continue
-			}
-			log.Infof("about to PUT all pods -- found %d pods", len(pods))
-			jsonBytes, err := json.Marshal(api.NewAllPods(pods))
-			if err != nil {
-				log.Errorf("unable to serialize all pods: %s", err.Error())
-				continue
-			}
-			resp, err := http.Post(allPodsURL, "application/json", bytes.NewBuffer(jsonBytes))
-			if err != nil {
-				log.Errorf("unable to POST to %s: %s", allPodsURL, err.Error())
-				continue
-			}
-			defer resp.Body.Close()
-			if err == nil && resp.StatusCode == 200 {
-				log.Infof("http POST request to %s succeeded", allPodsURL)
-			} else {
-				log.Errorf("http POST request to %s failed: %s", allPodsURL, err.Error())
-			}
+	// 5. accept a manifest via HTTP too -- POST /play with the same
+	//    multi-document YAML "kube play" accepts on the command line, for
+	//    callers that would rather hit perceiver over the network than
+	//    invoke the binary directly.
+	http.HandleFunc("/"+api.PlayPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "expected POST", http.StatusMethodNotAllowed)
+			return
 		}
-	}()
+		manifest, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		pods, err := clustermanager.PodsFromManifest(manifest)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode manifest: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		for _, pod := range pods {
+			perceptorClient.AddPod(pod)
+		}
+		bus.Infof("play: submitted %d pods from manifest for scanning", len(pods))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// 6. expose perceiver's own activity -- the same info/error events now
+	//    going through bus above -- as a stream of its own, independent of
+	//    core's /events.
+	http.Handle("/events", perceiver.NewEventStreamHandler(bus))
 
 	addr := fmt.Sprintf(":%s", api.PerceiverPort)
 	http.ListenAndServe(addr, nil)
-	log.Info("Http server started!")
+	bus.Infof("Http server started!")
 }
@@ -0,0 +1,149 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package clustermanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	policyViolationsAnnotation = "perceptor.blackduck.com/policy-violations"
+	vulnerabilitiesAnnotation  = "perceptor.blackduck.com/vulnerabilities"
+	overallStatusAnnotation    = "perceptor.blackduck.com/overall-status"
+
+	maxAnnotationConflictRetries = 5
+)
+
+// BlackDuckAnnotations is the set of pod annotations perceiver writes once
+// a scan's results are in.
+type BlackDuckAnnotations struct {
+	PolicyViolations int
+	Vulnerabilities  int
+	OverallStatus    string
+}
+
+// NewBlackDuckAnnotations builds the annotations perceiver sets on a pod
+// once its scan completes.
+func NewBlackDuckAnnotations(policyViolations int, vulnerabilities int, overallStatus string) *BlackDuckAnnotations {
+	return &BlackDuckAnnotations{
+		PolicyViolations: policyViolations,
+		Vulnerabilities:  vulnerabilities,
+		OverallStatus:    overallStatus,
+	}
+}
+
+func (a BlackDuckAnnotations) asMap() map[string]string {
+	return map[string]string{
+		policyViolationsAnnotation: fmt.Sprintf("%d", a.PolicyViolations),
+		vulnerabilitiesAnnotation:  fmt.Sprintf("%d", a.Vulnerabilities),
+		overallStatusAnnotation:    a.OverallStatus,
+	}
+}
+
+// KubeClient wraps a kubernetes clientset with the apiserver writes
+// perceiver needs.
+type KubeClient struct {
+	clientset kubernetes.Interface
+}
+
+// NewKubeClientFromCluster builds a KubeClient from the in-cluster
+// apiserver config.
+func NewKubeClientFromCluster() (*KubeClient, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to build in-cluster config: %s", err.Error())
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes clientset: %s", err.Error())
+	}
+	return &KubeClient{clientset: clientset}, nil
+}
+
+// SetBlackDuckPodAnnotations sets ann on the pod namespace/name, using the
+// resourceVersion observed by its own Get as an optimistic-concurrency
+// guard, in the same spirit as etcd3's "check the version you read is
+// still current" compare-and-swap: if another writer updates the pod
+// between our Get and our Patch, the apiserver rejects the patch with a
+// conflict and we retry from a fresh Get, up to
+// maxAnnotationConflictRetries times, rather than blindly overwriting
+// whatever they wrote. If the pod's annotations already match ann,
+// nothing is written at all.
+func (c *KubeClient) SetBlackDuckPodAnnotations(namespace string, name string, ann BlackDuckAnnotations) error {
+	desired := ann.asMap()
+
+	for attempt := 0; attempt <= maxAnnotationConflictRetries; attempt++ {
+		pod, err := c.clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get pod %s/%s: %s", namespace, name, err.Error())
+		}
+
+		if annotationsMatch(pod.Annotations, desired) {
+			return nil
+		}
+
+		patch, err := annotationPatch(pod.ResourceVersion, desired)
+		if err != nil {
+			return fmt.Errorf("unable to build annotation patch for %s/%s: %s", namespace, name, err.Error())
+		}
+
+		_, err = c.clientset.CoreV1().Pods(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err == nil {
+			return nil
+		}
+		if !apierrors.IsConflict(err) {
+			return fmt.Errorf("unable to patch annotations on pod %s/%s: %s", namespace, name, err.Error())
+		}
+		// lost the race to another writer -- loop around and retry from a
+		// fresh Get rather than clobbering whatever they just wrote.
+	}
+	return fmt.Errorf("unable to patch annotations on pod %s/%s: too many conflicting writers", namespace, name)
+}
+
+func annotationsMatch(current map[string]string, desired map[string]string) bool {
+	for key, value := range desired {
+		if current[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// annotationPatch builds a JSON merge patch that sets desired's
+// annotations, guarded by resourceVersion so the apiserver rejects it if
+// the pod has changed since we last read it.
+func annotationPatch(resourceVersion string, desired map[string]string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": resourceVersion,
+			"annotations":     desired,
+		},
+	})
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package clustermanager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	common "bitbucket.org/bdsengineering/perceptor/pkg/common"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// typeMeta is decoded from each document in a manifest first, to learn its
+// kind before committing to a concrete type.
+type typeMeta struct {
+	metav1.TypeMeta `json:",inline"`
+}
+
+// PodsFromManifest decodes a multi-document Kubernetes YAML (or JSON)
+// manifest -- e.g. the output of `kubectl get -o yaml`, or one checked
+// into a repo for CI -- into the synthetic pods it describes, without any
+// of it needing to actually be running in-cluster. Pod documents are used
+// as-is; Deployment and DaemonSet documents are expanded into one
+// synthetic pod built from their pod template, so perceptor can scan a
+// manifest before it's ever deployed.
+func PodsFromManifest(manifest []byte) ([]common.Pod, error) {
+	var pods []common.Pod
+	for i, doc := range splitYAMLDocuments(manifest) {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		var meta typeMeta
+		if err := yaml.Unmarshal(doc, &meta); err != nil {
+			return nil, fmt.Errorf("unable to decode document %d: %s", i, err.Error())
+		}
+		switch meta.Kind {
+		case "Pod":
+			var kubePod corev1.Pod
+			if err := yaml.Unmarshal(doc, &kubePod); err != nil {
+				return nil, fmt.Errorf("unable to decode Pod in document %d: %s", i, err.Error())
+			}
+			pods = append(pods, podFromManifestSpec(kubePod.ObjectMeta, kubePod.Spec))
+		case "Deployment":
+			var deployment appsv1.Deployment
+			if err := yaml.Unmarshal(doc, &deployment); err != nil {
+				return nil, fmt.Errorf("unable to decode Deployment in document %d: %s", i, err.Error())
+			}
+			pods = append(pods, podFromWorkloadTemplate(deployment.ObjectMeta, deployment.Spec.Template))
+		case "DaemonSet":
+			var daemonSet appsv1.DaemonSet
+			if err := yaml.Unmarshal(doc, &daemonSet); err != nil {
+				return nil, fmt.Errorf("unable to decode DaemonSet in document %d: %s", i, err.Error())
+			}
+			pods = append(pods, podFromWorkloadTemplate(daemonSet.ObjectMeta, daemonSet.Spec.Template))
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("document %d: unsupported kind %q", i, meta.Kind)
+		}
+	}
+	return pods, nil
+}
+
+// podFromWorkloadTemplate builds the single synthetic pod representing a
+// Deployment or DaemonSet's pod template -- there's exactly one regardless
+// of replica count, since nothing is actually being scheduled.
+func podFromWorkloadTemplate(workloadMeta metav1.ObjectMeta, template corev1.PodTemplateSpec) common.Pod {
+	meta := template.ObjectMeta
+	if meta.Name == "" {
+		meta.Name = workloadMeta.Name
+	}
+	if meta.Namespace == "" {
+		meta.Namespace = workloadMeta.Namespace
+	}
+	return podFromManifestSpec(meta, template.Spec)
+}
+
+// podFromManifestSpec flattens a pod spec's init, ephemeral, and regular
+// containers into a single synthetic common.Pod. Unlike NewPod (used for
+// pods actually running in-cluster), it includes init and ephemeral
+// containers too: the point of scanning a manifest before deploy is to
+// catch a vulnerable image wherever it appears, not just in the pod's
+// steady-state containers.
+func podFromManifestSpec(meta metav1.ObjectMeta, spec corev1.PodSpec) common.Pod {
+	containers := make([]common.Container, 0, len(spec.InitContainers)+len(spec.Containers)+len(spec.EphemeralContainers))
+	for _, kubeContainer := range spec.InitContainers {
+		containers = append(containers, common.Container{Name: kubeContainer.Name, Image: *common.NewImage(kubeContainer.Image)})
+	}
+	for _, kubeContainer := range spec.Containers {
+		containers = append(containers, common.Container{Name: kubeContainer.Name, Image: *common.NewImage(kubeContainer.Image)})
+	}
+	for _, kubeContainer := range spec.EphemeralContainers {
+		containers = append(containers, common.Container{Name: kubeContainer.Name, Image: *common.NewImage(kubeContainer.Image)})
+	}
+	return common.Pod{
+		Namespace:  meta.Namespace,
+		Name:       meta.Name,
+		UID:        string(meta.UID),
+		Containers: containers,
+	}
+}
+
+// splitYAMLDocuments splits a multi-document YAML manifest on "---"
+// separator lines.
+func splitYAMLDocuments(manifest []byte) [][]byte {
+	var docs [][]byte
+	var current bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if bytes.Equal(bytes.TrimSpace([]byte(line)), []byte("---")) {
+			docs = append(docs, append([]byte(nil), current.Bytes()...))
+			current.Reset()
+			continue
+		}
+		current.WriteString(line)
+		current.WriteByte('\n')
+	}
+	docs = append(docs, append([]byte(nil), current.Bytes()...))
+	return docs
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package clustermanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	common "bitbucket.org/bdsengineering/perceptor/pkg/common"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodReflector watches pods across the cluster with a client-go Reflector
+// backed by a DeltaFIFO, translating the deltas it observes into
+// AddPod/UpdatePod/DeletePod events. It replaces the old "PUT all pods
+// every 20 seconds" hack: each time the Reflector relists (its initial
+// list, and each restart of its list-and-watch), a Sync delta is emitted
+// (on the same channel as AddPod, since perceptor already treats a pod
+// POST idempotently) for every pod listed, without a second polling loop
+// or a second HTTP round trip. The DeltaFIFO has no known-objects store,
+// so the Reflector's periodic resync adds no Sync deltas in between.
+type PodReflector struct {
+	fifo      *cache.DeltaFIFO
+	reflector *cache.Reflector
+
+	addPod    chan AddPod
+	updatePod chan UpdatePod
+	deletePod chan DeletePod
+
+	mu    sync.Mutex
+	known map[string]common.Pod
+}
+
+// NewPodReflector builds a PodReflector from the in-cluster apiserver
+// config, listing and watching pods across all namespaces. resyncPeriod is
+// the Reflector's resync period, which with this DeltaFIFO emits no
+// deltas; it does not make the Reflector relist. Call Run to start it.
+func NewPodReflector(resyncPeriod time.Duration) (*PodReflector, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to build in-cluster config: %s", err.Error())
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes clientset: %s", err.Error())
+	}
+
+	fifo := cache.NewDeltaFIFO(cache.MetaNamespaceKeyFunc, nil)
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return clientset.CoreV1().Pods(metav1.NamespaceAll).Watch(context.TODO(), options)
+		},
+	}
+	return &PodReflector{
+		fifo:      fifo,
+		reflector: cache.NewReflector(listWatch, &v1.Pod{}, fifo, resyncPeriod),
+		addPod:    make(chan AddPod),
+		updatePod: make(chan UpdatePod),
+		deletePod: make(chan DeletePod),
+		known:     make(map[string]common.Pod),
+	}, nil
+}
+
+// PodAdd delivers an event for every pod the reflector sees added, and for
+// every pod still present after a relist (a Sync delta) -- the latter is
+// what replaces the old periodic full-resync.
+func (r *PodReflector) PodAdd() <-chan AddPod { return r.addPod }
+
+// PodUpdate delivers an event each time a watched pod changes.
+func (r *PodReflector) PodUpdate() <-chan UpdatePod { return r.updatePod }
+
+// PodDelete delivers an event each time a watched pod is removed.
+func (r *PodReflector) PodDelete() <-chan DeletePod { return r.deletePod }
+
+// GetAllPods returns a snapshot of every pod currently known to the
+// reflector, built entirely from its local delta cache -- no apiserver
+// call required.
+func (r *PodReflector) GetAllPods() ([]common.Pod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pods := make([]common.Pod, 0, len(r.known))
+	for _, pod := range r.known {
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// Run starts the underlying Reflector and drains deltas from its FIFO,
+// dispatching them to PodAdd/PodUpdate/PodDelete until stopCh is closed.
+func (r *PodReflector) Run(stopCh <-chan struct{}) {
+	go r.reflector.Run(stopCh)
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		_, err := r.fifo.Pop(func(obj interface{}) error {
+			return r.processDeltas(obj.(cache.Deltas))
+		})
+		if err != nil {
+			if err == cache.ErrFIFOClosed {
+				return
+			}
+			log.Errorf("pod reflector: error popping delta: %s", err.Error())
+		}
+	}
+}
+
+func (r *PodReflector) processDeltas(deltas cache.Deltas) error {
+	for _, delta := range deltas {
+		kubePod, ok := delta.Object.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		newPod := NewPod(kubePod)
+		key := newPod.QualifiedName()
+
+		switch delta.Type {
+		case cache.Added, cache.Sync:
+			r.mu.Lock()
+			r.known[key] = newPod
+			r.mu.Unlock()
+			r.addPod <- AddPod{New: newPod}
+		case cache.Updated:
+			r.mu.Lock()
+			oldPod := r.known[key]
+			r.known[key] = newPod
+			r.mu.Unlock()
+			r.updatePod <- UpdatePod{Old: oldPod, New: newPod}
+		case cache.Deleted:
+			r.mu.Lock()
+			delete(r.known, key)
+			r.mu.Unlock()
+			r.deletePod <- DeletePod{QualifiedName: key}
+		}
+	}
+	return nil
+}
+
+// NewPod converts a kubernetes pod object into perceptor's common.Pod.
+func NewPod(kubePod *v1.Pod) common.Pod {
+	containers := make([]common.Container, 0, len(kubePod.Spec.Containers))
+	for _, kubeContainer := range kubePod.Spec.Containers {
+		containers = append(containers, common.Container{
+			Name:  kubeContainer.Name,
+			Image: *common.NewImage(kubeContainer.Image),
+		})
+	}
+	return common.Pod{
+		Namespace:  kubePod.Namespace,
+		Name:       kubePod.Name,
+		UID:        string(kubePod.UID),
+		Containers: containers,
+	}
+}
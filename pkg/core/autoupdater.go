@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/docker"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// AutoUpdateDisabledAnnotation, when set to "disabled" on a pod spec, opts
+// every image in that pod out of auto-update re-resolution. Any other value
+// leaves auto-update on.
+const AutoUpdateDisabledAnnotation = "perceptor.blackduck.com/autoupdate"
+
+const autoUpdateDisabledValue = "disabled"
+
+// autoUpdateMinBackOff bounds how often a single image's tag is
+// re-resolved, regardless of the AutoUpdater's configured interval, so a
+// rapidly-changing `:latest` tag can't saturate the hub-check queue.
+const autoUpdateMinBackOff = 1 * time.Minute
+
+// AutoUpdater periodically re-resolves the mutable tags already present in
+// a Model against their source registry, re-queuing any image whose
+// digest has drifted since it was last discovered. It is the Perceptor
+// analogue of podman's autoupdate package.
+type AutoUpdater struct {
+	model    *Model
+	source   docker.ImageSource
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[DockerImageSha]time.Time
+
+	driftedThisCycle prometheus.Gauge
+}
+
+// NewAutoUpdater returns an AutoUpdater that re-checks tags in model every
+// interval using source to resolve the current digest.
+func NewAutoUpdater(model *Model, source docker.ImageSource, interval time.Duration) *AutoUpdater {
+	u := &AutoUpdater{
+		model:    model,
+		source:   source,
+		interval: interval,
+		lastSeen: make(map[DockerImageSha]time.Time),
+	}
+	u.driftedThisCycle = registerGauge(prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "perceptor",
+		Subsystem: "core",
+		Name:      "autoupdate_drifted_images",
+		Help:      "number of images whose digest drifted in the most recent autoupdate cycle",
+	}))
+	return u
+}
+
+// Run re-resolves tags every interval until ctx is cancelled.
+func (u *AutoUpdater) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.runOnce(ctx)
+		}
+	}
+}
+
+func (u *AutoUpdater) runOnce(ctx context.Context) {
+	drifted := 0
+	for sha, imageInfo := range u.snapshotImages() {
+		if isPinnedDigest(imageInfo.Name) {
+			continue
+		}
+		if u.isDisabled(sha) {
+			continue
+		}
+		if !u.dueForRecheck(sha) {
+			continue
+		}
+
+		digest, err := u.source.Resolve(ctx, imageInfo.Name, "")
+		if err != nil {
+			log.Errorf("autoupdater: unable to resolve %s: %s", imageInfo.Name, err.Error())
+			continue
+		}
+		if DockerImageSha(digest) == sha {
+			continue
+		}
+
+		log.Infof("autoupdater: %s drifted from %s to %s, re-queuing", imageInfo.Name, sha, digest)
+		err = u.model.AddResolvedImage(docker.ResolvedImage{
+			Image:  docker.Image{Name: imageInfo.Name, Digest: digest},
+			Digest: digest,
+		})
+		if err != nil {
+			log.Errorf("autoupdater: unable to re-queue %s: %s", imageInfo.Name, err.Error())
+			continue
+		}
+		drifted++
+	}
+	u.driftedThisCycle.Set(float64(drifted))
+}
+
+func (u *AutoUpdater) snapshotImages() map[DockerImageSha]*ImageInfo {
+	snapshot := make(map[DockerImageSha]*ImageInfo, len(u.model.Images))
+	for sha, info := range u.model.Images {
+		snapshot[sha] = info
+	}
+	return snapshot
+}
+
+func (u *AutoUpdater) dueForRecheck(sha DockerImageSha) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	last, ok := u.lastSeen[sha]
+	if ok && time.Since(last) < autoUpdateMinBackOff {
+		return false
+	}
+	u.lastSeen[sha] = time.Now()
+	return true
+}
+
+// isDisabled reports whether any pod currently referencing sha opted out
+// of auto-update via AutoUpdateDisabledAnnotation.
+func (u *AutoUpdater) isDisabled(sha DockerImageSha) bool {
+	for _, pod := range u.model.Pods {
+		for _, cont := range pod.Containers {
+			if cont.Image.Sha != sha {
+				continue
+			}
+			if pod.Annotations[AutoUpdateDisabledAnnotation] == autoUpdateDisabledValue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPinnedDigest reports whether ref already names a manifest digest
+// rather than a mutable tag, e.g. "repo@sha256:...".
+func isPinnedDigest(ref string) bool {
+	for i := len(ref) - 1; i >= 0; i-- {
+		switch ref[i] {
+		case '@':
+			return true
+		case '/':
+			return false
+		}
+	}
+	return false
+}
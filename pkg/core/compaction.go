@@ -0,0 +1,64 @@
+package core
+
+import "fmt"
+
+// Compact snapshots the model's current state as a minimal set of events
+// -- for each image an EventImageDiscovered followed by whatever event
+// reproduces its current ScanStatus, then one EventPodAdded per known pod
+// -- and asks the store to replace the full log with it. This keeps the
+// log from growing without bound over the life of a long-running perceptor
+// process. Images still waiting for a hub check are discovered after all
+// the others, so each EventHubCheckStarted (which pops the hub check
+// queue's head) pops the image it was recorded for; pods come last, so
+// their already-known images aren't enqueued for a hub check again.
+func (model *Model) Compact() error {
+	if model.store == nil {
+		return nil
+	}
+
+	snapshot := []Event{}
+	waiting := []Event{}
+	for sha, info := range model.Images {
+		image := info.image()
+		snapshot = append(snapshot, Event{Kind: EventImageDiscovered, Sha: sha, Image: image})
+		switch info.ScanStatus {
+		case ScanStatusUnknown, ScanStatusInHubCheckQueue:
+			// both already reachable from the ImageDiscovered event above,
+			// which is moved to the end of the image events
+			waiting = append(waiting, snapshot[len(snapshot)-1])
+			snapshot = snapshot[:len(snapshot)-1]
+		case ScanStatusCheckingHub:
+			snapshot = append(snapshot, Event{Kind: EventHubCheckStarted, Sha: sha, Image: image})
+		case ScanStatusInQueue:
+			snapshot = append(snapshot,
+				Event{Kind: EventHubCheckStarted, Sha: sha, Image: image},
+				Event{Kind: EventScanQueued, Sha: sha})
+		case ScanStatusRunningScanClient, ScanStatusRunningHubScan:
+			snapshot = append(snapshot,
+				Event{Kind: EventHubCheckStarted, Sha: sha, Image: image},
+				Event{Kind: EventScanQueued, Sha: sha},
+				Event{Kind: EventScanStarted, Sha: sha, Image: image})
+			if info.ScanStatus == ScanStatusRunningHubScan {
+				snapshot = append(snapshot, Event{Kind: EventScanFinished, Sha: sha, Image: image})
+			}
+		case ScanStatusError, ScanStatusRejectedByPolicy, ScanStatusComplete:
+			// Terminal states have no queue transition that reaches them,
+			// and replaying the ImageDiscovered event above alone would
+			// auto-enqueue the image into the hub check queue -- undoing,
+			// for example, a trust-policy rejection on every restart. Mark
+			// that ImageDiscovered event to skip the auto-enqueue, and
+			// restore the terminal status directly instead.
+			snapshot[len(snapshot)-1].SkipHubCheckQueue = true
+			snapshot = append(snapshot, Event{Kind: EventImageStatusRestored, Sha: sha, Status: info.ScanStatus})
+		}
+	}
+	snapshot = append(snapshot, waiting...)
+	for _, pod := range model.Pods {
+		snapshot = append(snapshot, Event{Kind: EventPodAdded, Pod: pod})
+	}
+
+	if err := model.store.Compact(snapshot); err != nil {
+		return fmt.Errorf("unable to compact event log: %v", err)
+	}
+	return nil
+}
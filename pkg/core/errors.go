@@ -0,0 +1,28 @@
+package core
+
+import "fmt"
+
+// ErrUnknownImage is returned when an operation references a sha the
+// model doesn't have a record for -- either it was never discovered, or
+// a compaction snapshot predates it and the event that discovered it
+// hasn't been replayed yet.
+type ErrUnknownImage struct {
+	Sha DockerImageSha
+}
+
+func (e *ErrUnknownImage) Error() string {
+	return fmt.Sprintf("expected to already have image %s, but did not", string(e.Sha))
+}
+
+// ErrIllegalTransition is returned when an event would move an image's
+// ScanStatus somewhere the state machine doesn't allow from its current
+// status, e.g. finishing a scan that was never started.
+type ErrIllegalTransition struct {
+	Sha  DockerImageSha
+	From ScanStatus
+	Kind EventKind
+}
+
+func (e *ErrIllegalTransition) Error() string {
+	return fmt.Sprintf("cannot apply %s to image %s, illegal from status %s", e.Kind, e.Sha, e.From)
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"bitbucket.org/bdsengineering/perceptor/pkg/eventbus"
+)
+
+// eventBusBufferSize bounds both the replay ring buffer (for clients
+// reconnecting with a `since` cursor) and each subscriber's backlog.
+const eventBusBufferSize = 1024
+
+// eventBus fans out published events to /events subscribers. It's a thin
+// typed wrapper around pkg/eventbus.Bus, the ring-buffered pub/sub logic
+// shared with pkg/perceiver's activity stream.
+type eventBus struct {
+	bus     *eventbus.Bus
+	metrics *metrics
+}
+
+func newEventBus(m *metrics) *eventBus {
+	b := &eventBus{metrics: m}
+	b.bus = eventbus.New(eventBusBufferSize, eventbus.Hooks{
+		OnDrop: func() {
+			if b.metrics != nil {
+				b.metrics.eventDropped()
+			}
+		},
+		OnSubscriberConnect: func() {
+			if b.metrics != nil {
+				b.metrics.eventSubscriberConnected()
+			}
+		},
+		OnSubscriberDisconnect: func() {
+			if b.metrics != nil {
+				b.metrics.eventSubscriberDisconnected()
+			}
+		},
+	})
+	return b
+}
+
+// publish stamps event with the next sequence number, records it in the
+// replay ring, and forwards it to every live subscriber.
+func (b *eventBus) publish(event Event) {
+	b.bus.Publish(func(seq uint64) interface{} {
+		event.Seq = seq
+		return event
+	})
+}
@@ -0,0 +1,63 @@
+package core
+
+import "time"
+
+// EventKind names the kinds of mutation that can be applied to a Model.
+// The event log is the source of truth for a Model's state: replaying
+// every event in order from an empty Model reconstructs it exactly.
+type EventKind string
+
+const (
+	EventPodAdded            EventKind = "PodAdded"
+	EventPodDeleted          EventKind = "PodDeleted"
+	EventImageDiscovered     EventKind = "ImageDiscovered"
+	EventImageStatusRestored EventKind = "ImageStatusRestored"
+	EventHubCheckQueued      EventKind = "HubCheckQueued"
+	EventHubCheckStarted     EventKind = "HubCheckStarted"
+	EventScanQueued          EventKind = "ScanQueued"
+	EventScanStarted         EventKind = "ScanStarted"
+	EventScanRequeued        EventKind = "ScanRequeued"
+	EventScanFinished        EventKind = "ScanFinished"
+)
+
+// Event is a single append-only log entry recording one mutation applied
+// to a Model. Only the fields relevant to Kind are populated.
+type Event struct {
+	// Seq is a monotonically increasing cursor assigned when the event is
+	// published to live subscribers (see eventBus), used for the
+	// /events?since= query parameter. It is not persisted by EventStore
+	// and is not set on events returned from Replay.
+	Seq     uint64
+	Kind    EventKind
+	Sha     DockerImageSha
+	Image   Image
+	Pod     Pod
+	PodName string
+	// Status is only set on EventImageStatusRestored, to the terminal
+	// status being restored.
+	Status ScanStatus
+	// SkipHubCheckQueue is only meaningful on EventImageDiscovered: a
+	// compacted snapshot sets it so the image is seeded into the model
+	// without re-entering the hub check queue, because a following
+	// EventImageStatusRestored is about to set its real (terminal)
+	// status.
+	SkipHubCheckQueue bool
+	Timestamp         time.Time
+}
+
+// EventStore persists a Model's event log so that a restart can replay it
+// instead of starting from an empty model and forgetting every in-flight
+// scan. Implementations must preserve append order.
+type EventStore interface {
+	// Append durably records event as the next entry in the log.
+	Append(event Event) error
+	// Replay returns every event recorded since the last Compact, in the
+	// order they were appended.
+	Replay() ([]Event, error)
+	// Compact replaces the log with snapshot, a minimal set of events
+	// that reconstructs the same state (typically one ImageDiscovered
+	// plus the current in-flight event per image, and one PodAdded per
+	// known pod). It lets the log be truncated instead of growing
+	// forever.
+	Compact(snapshot []Event) error
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var eventsBucket = []byte("events")
+
+// BoltEventStore is the default EventStore, persisting the event log to a
+// single BoltDB file so a restarted perceptor can recover in-flight scans
+// instead of losing track of them.
+type BoltEventStore struct {
+	db *bolt.DB
+}
+
+// NewBoltEventStore opens (creating if necessary) a BoltDB file at path to
+// use as the backing store for a Model's event log.
+func NewBoltEventStore(path string) (*BoltEventStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open event store %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize event store %s: %v", path, err)
+	}
+	return &BoltEventStore{db: db}, nil
+}
+
+// Close releases the underlying BoltDB file.
+func (s *BoltEventStore) Close() error {
+	return s.db.Close()
+}
+
+// Append implements EventStore.
+func (s *BoltEventStore) Append(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal event %s: %v", event.Kind, err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(sequenceKey(seq), data)
+	})
+}
+
+// Replay implements EventStore.
+func (s *BoltEventStore) Replay() ([]Event, error) {
+	events := []Event{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		return bucket.ForEach(func(_, data []byte) error {
+			var event Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return fmt.Errorf("unable to unmarshal event: %v", err)
+			}
+			events = append(events, event)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Compact implements EventStore by replacing the bucket's contents with
+// snapshot, re-keyed starting from sequence 1.
+func (s *BoltEventStore) Compact(snapshot []Event) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(eventsBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		bucket, err := tx.CreateBucket(eventsBucket)
+		if err != nil {
+			return err
+		}
+		for _, event := range snapshot {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("unable to marshal event %s: %v", event.Kind, err)
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(sequenceKey(seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,22 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/eventbus"
+)
+
+// newEventStreamHandler returns the GET /events handler: it streams events
+// published to bus as they happen, replaying anything still in the ring
+// buffer newer than the `since` query parameter first. The framing is
+// negotiated from the Accept header -- "text/event-stream" gets SSE,
+// anything else (including no Accept header) gets newline-delimited JSON.
+// This is the pkg/eventbus generic stream handler with no event filter,
+// since core streams every domain event.
+func newEventStreamHandler(bus *eventBus, idleTimeout time.Duration) http.Handler {
+	if idleTimeout <= 0 {
+		idleTimeout = 5 * time.Minute
+	}
+	return eventbus.NewHandler(bus.bus, idleTimeout, nil)
+}
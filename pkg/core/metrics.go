@@ -20,6 +20,9 @@ type metrics struct {
 	statusGauge        *prometheus.GaugeVec
 	// prometheus' terminology is so confusing ... a histogram isn't a histogram.  sometimes.
 	statusHistogram *prometheus.GaugeVec
+
+	activeEventSubscribers prometheus.Gauge
+	droppedEvents          prometheus.Counter
 }
 
 func newMetrics() *metrics {
@@ -77,6 +80,20 @@ func (m *metrics) httpError(request *http.Request, err error) {
 	m.handledHTTPRequest.With(prometheus.Labels{"path": path, "method": method, "code": "500"}).Inc()
 }
 
+// event stream
+
+func (m *metrics) eventSubscriberConnected() {
+	m.activeEventSubscribers.Inc()
+}
+
+func (m *metrics) eventSubscriberDisconnected() {
+	m.activeEventSubscribers.Dec()
+}
+
+func (m *metrics) eventDropped() {
+	m.droppedEvents.Inc()
+}
+
 // model
 
 func (m *metrics) updateModel(model Model) {
@@ -167,9 +184,25 @@ func (m *metrics) setup() {
 		Help:      "a histogram of statuses for perceptor core's current state",
 	}, []string{"name", "count"})
 
+	m.activeEventSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "perceptor",
+		Subsystem: "core",
+		Name:      "event_stream_active_subscribers",
+		Help:      "number of clients currently subscribed to the /events stream",
+	})
+
+	m.droppedEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "perceptor",
+		Subsystem: "core",
+		Name:      "event_stream_dropped_events_total",
+		Help:      "number of events dropped because a /events subscriber was too slow to keep up",
+	})
+
 	prometheus.MustRegister(m.handledHTTPRequest)
 	prometheus.MustRegister(m.statusGauge)
 	prometheus.MustRegister(m.statusHistogram)
+	prometheus.MustRegister(m.activeEventSubscribers)
+	prometheus.MustRegister(m.droppedEvents)
 
 	go func() {
 		m.generateStatusMetrics()
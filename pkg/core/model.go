@@ -23,7 +23,11 @@ package core
 
 import (
 	"fmt"
+	"net/http"
+	"time"
 
+	"bitbucket.org/bdsengineering/perceptor/pkg/docker"
+	"bitbucket.org/bdsengineering/perceptor/pkg/trust"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -35,19 +39,122 @@ type Model struct {
 	ImageScanQueue      []Image
 	ImageHubCheckQueue  []Image
 	ConcurrentScanLimit int
+	// TrustPolicy, if set, is consulted in addImageToScanQueue before an
+	// image is allowed to leave ScanStatusCheckingHub for the scan queue.
+	// A nil TrustPolicy preserves the old behavior of trusting everything.
+	TrustPolicy *trust.Policy
+	// store is the event log backing this Model. A nil store means
+	// mutations aren't persisted, which is fine for tests but means a
+	// restart starts from empty instead of recovering in-flight scans.
+	store EventStore
+	// bus fans out applied events to /events subscribers. It's always
+	// present (NewModel allocates it) even when store is nil.
+	bus *eventBus
+	// Scheduler, if set, replaces plain FIFO scan-queue ordering with
+	// per-namespace fair-share, pod-annotation priority classes, and
+	// per-registry concurrency caps. A nil Scheduler preserves the old
+	// FIFO behavior.
+	Scheduler *Scheduler
 }
 
-func NewModel(concurrentScanLimit int) *Model {
-	return &Model{
+// NewModel constructs a Model and, if store is non-nil, replays its event
+// log to reconstruct state from a prior run -- so a restart doesn't orphan
+// images that were ScanStatusRunningScanClient when the process died.
+func NewModel(concurrentScanLimit int, store EventStore) (*Model, error) {
+	model := &Model{
 		Pods:                make(map[string]Pod),
 		Images:              make(map[DockerImageSha]*ImageInfo),
 		ImageScanQueue:      []Image{},
 		ImageHubCheckQueue:  []Image{},
-		ConcurrentScanLimit: concurrentScanLimit}
+		ConcurrentScanLimit: concurrentScanLimit,
+		store:               store,
+		bus:                 newEventBus(nil),
+	}
+	if store == nil {
+		return model, nil
+	}
+	events, err := store.Replay()
+	if err != nil {
+		return nil, fmt.Errorf("unable to replay event log: %v", err)
+	}
+	for _, event := range events {
+		if err := model.apply(event); err != nil {
+			return nil, fmt.Errorf("unable to replay event %s for image %s: %v", event.Kind, event.Sha, err)
+		}
+	}
+	return model, nil
+}
+
+// Apply mutates the model according to event and, if a store is
+// configured, durably appends it to the event log. This is the only path
+// that should be used to mutate a Model once it's been constructed --
+// DeletePod, AddPod, and AddImage are thin wrappers around it.
+func (model *Model) Apply(event Event) error {
+	if err := model.apply(event); err != nil {
+		return err
+	}
+	event.Timestamp = time.Now()
+	if model.store != nil {
+		if err := model.store.Append(event); err != nil {
+			return fmt.Errorf("applied event %s but failed to persist it: %v", event.Kind, err)
+		}
+	}
+	model.bus.publish(event)
+	return nil
+}
+
+// SetMetrics points the model's /events subscriber bookkeeping at m, so
+// active-subscriber and dropped-event counts show up in the rest of
+// core's Prometheus metrics.
+func (model *Model) SetMetrics(m *metrics) {
+	model.bus.metrics = m
+}
+
+// Events returns a handler for GET /events, streaming this model's applied
+// events as either newline-delimited JSON or server-sent events (chosen
+// via the request's Accept header), starting after the `since` cursor if
+// one is given. idleTimeout closes a connection that no subscriber has
+// drained in that long.
+func (model *Model) Events(idleTimeout time.Duration) http.Handler {
+	return newEventStreamHandler(model.bus, idleTimeout)
+}
+
+func (model *Model) apply(event Event) error {
+	switch event.Kind {
+	case EventPodAdded:
+		return model.applyAddPod(event.Pod)
+	case EventPodDeleted:
+		model.applyDeletePod(event.PodName)
+		return nil
+	case EventImageDiscovered:
+		return model.applyAddImage(event.Image, event.SkipHubCheckQueue)
+	case EventImageStatusRestored:
+		return model.applyRestoreImageStatus(event.Sha, event.Status)
+	case EventHubCheckQueued:
+		return model.applyAddImageToHubCheckQueue(event.Sha)
+	case EventHubCheckStarted:
+		_, err := model.applyGetNextImageFromHubCheckQueue()
+		return err
+	case EventScanQueued:
+		return model.applyAddImageToScanQueue(event.Sha)
+	case EventScanRequeued:
+		return model.applyErrorRunningScanClient(event.Image)
+	case EventScanStarted:
+		_, err := model.applyScanStarted(event.Sha)
+		return err
+	case EventScanFinished:
+		return model.applyFinishRunningScanClient(event.Image)
+	default:
+		return fmt.Errorf("unknown event kind %q", event.Kind)
+	}
 }
 
 // DeletePod removes the record of a pod, but does not affect images.
-func (model *Model) DeletePod(podName string) {
+func (model *Model) DeletePod(podName string) error {
+	return model.Apply(Event{Kind: EventPodDeleted, PodName: podName})
+}
+
+func (model *Model) applyDeletePod(podName string) {
 	delete(model.Pods, podName)
 }
 
@@ -57,133 +164,308 @@ func (model *Model) DeletePod(podName string) {
 // The key is the combination of the pod's namespace and name.
 // It extract the containers and images from the pod,
 // adding them into the cache.
-func (model *Model) AddPod(newPod Pod) {
+func (model *Model) AddPod(newPod Pod) error {
+	return model.Apply(Event{Kind: EventPodAdded, Pod: newPod})
+}
+
+func (model *Model) applyAddPod(newPod Pod) error {
 	log.Debugf("about to add pod: UID %s, qualified name %s", newPod.UID, newPod.QualifiedName())
 	for _, newCont := range newPod.Containers {
-		model.AddImage(newCont.Image)
+		if err := model.applyAddImage(newCont.Image, false); err != nil {
+			return err
+		}
 	}
 	log.Debugf("done adding containers+images from pod %s -- %s", newPod.UID, newPod.QualifiedName())
 	model.Pods[newPod.QualifiedName()] = newPod
+	return nil
 }
 
 // AddImage adds an image to the model, sets its status to NotScanned,
 // and adds it to the queue for hub checking.
-func (model *Model) AddImage(image Image) {
+func (model *Model) AddImage(image Image) error {
+	return model.Apply(Event{Kind: EventImageDiscovered, Sha: image.Sha, Image: image})
+}
+
+// applyAddImage records image in the model if it isn't already known. A
+// freshly-discovered image normally goes straight into the hub check queue
+// -- but skipHubCheckQueue lets a compacted EventImageDiscovered seed the
+// ImageInfo entry alone, for an image whose terminal status is about to be
+// set by a following EventImageStatusRestored, without routing it back
+// through the pipeline it already finished.
+func (model *Model) applyAddImage(image Image, skipHubCheckQueue bool) error {
 	_, hasImage := model.Images[image.Sha]
 	if !hasImage {
 		newInfo := NewImageInfo(image.Sha, image.Name)
 		model.Images[image.Sha] = newInfo
 		log.Debugf("added image %s to model", image.HumanReadableName())
-		model.addImageToHubCheckQueue(image.Sha)
-	} else {
-		log.Debugf("not adding image %s to model, already have in cache", image.HumanReadableName())
+		if skipHubCheckQueue {
+			return nil
+		}
+		return model.applyAddImageToHubCheckQueue(image.Sha)
+	}
+	log.Debugf("not adding image %s to model, already have in cache", image.HumanReadableName())
+	return nil
+}
+
+// applyRestoreImageStatus sets sha's ScanStatus directly, bypassing the
+// normal queue-transition validation. It exists only for compaction
+// replay: a terminal status (Error, RejectedByPolicy, Complete) has no
+// queue to be reachable through, so it must be restored as-is rather than
+// re-derived by replaying transitions.
+func (model *Model) applyRestoreImageStatus(sha DockerImageSha, status ScanStatus) error {
+	imageInfo, err := model.safeGet(sha)
+	if err != nil {
+		return err
 	}
+	imageInfo.ScanStatus = status
+	return nil
+}
+
+// AddResolvedImage adds an image to the model the same way AddImage does,
+// but keys it by the manifest digest a docker.ImageSource already resolved
+// rather than a Docker-daemon-assigned sha. ImageInfo.OriginalReference
+// retains the tag/name the pod spec used, so if an image is rebuilt under
+// the same tag, the new digest re-enters the hub check queue as a distinct
+// entry instead of being treated as already-scanned.
+func (model *Model) AddResolvedImage(resolved docker.ResolvedImage) error {
+	sha := DockerImageSha(resolved.Digest)
+	return model.AddImage(Image{Sha: sha, Name: resolved.Image.Name})
 }
 
 // image state transitions
 
-func (model *Model) safeGet(sha DockerImageSha) *ImageInfo {
+func (model *Model) safeGet(sha DockerImageSha) (*ImageInfo, error) {
 	results, ok := model.Images[sha]
 	if !ok {
-		message := fmt.Sprintf("expected to already have image %s, but did not", string(sha))
-		log.Error(message)
-		panic(message) // TODO get rid of panic
+		return nil, &ErrUnknownImage{Sha: sha}
 	}
-	return results
+	return results, nil
 }
 
-func (model *Model) addImageToHubCheckQueue(sha DockerImageSha) {
-	imageInfo := model.safeGet(sha)
+func (model *Model) applyAddImageToHubCheckQueue(sha DockerImageSha) error {
+	imageInfo, err := model.safeGet(sha)
+	if err != nil {
+		return err
+	}
 	switch imageInfo.ScanStatus {
 	case ScanStatusUnknown, ScanStatusError:
 		break
 	default:
-		message := fmt.Sprintf("cannot add image %s to hub check queue, status is neither Unknown nor Error (%s)", sha, imageInfo.ScanStatus)
-		log.Error(message)
-		panic(message) // TODO get rid of panic
+		return &ErrIllegalTransition{Sha: sha, From: imageInfo.ScanStatus, Kind: EventHubCheckQueued}
 	}
 	imageInfo.ScanStatus = ScanStatusInHubCheckQueue
 	model.ImageHubCheckQueue = append(model.ImageHubCheckQueue, imageInfo.image())
+	return nil
 }
 
-func (model *Model) addImageToScanQueue(sha DockerImageSha) {
-	imageInfo := model.safeGet(sha)
+func (model *Model) applyAddImageToScanQueue(sha DockerImageSha) error {
+	imageInfo, err := model.safeGet(sha)
+	if err != nil {
+		return err
+	}
 	switch imageInfo.ScanStatus {
 	case ScanStatusCheckingHub, ScanStatusError:
 		break
 	default:
-		message := fmt.Sprintf("cannot add image %s to scan queue, status is neither CheckingHub nor Error (%s)", sha, imageInfo.ScanStatus)
-		log.Error(message)
-		panic(message) // TODO get rid of panic
+		return &ErrIllegalTransition{Sha: sha, From: imageInfo.ScanStatus, Kind: EventScanQueued}
+	}
+
+	if model.TrustPolicy != nil {
+		verdict, err := model.TrustPolicy.Evaluate(imageInfo.Name, verifySignature)
+		if err != nil {
+			log.Errorf("unable to evaluate trust policy for %s: %s", imageInfo.Name, err.Error())
+			verdict = trust.Verdict{Allowed: false, Reason: err.Error()}
+		}
+		if !verdict.Allowed {
+			log.Infof("rejecting image %s by trust policy: %s", imageInfo.Name, verdict.Reason)
+			imageInfo.ScanStatus = ScanStatusRejectedByPolicy
+			return nil
+		}
 	}
+
 	imageInfo.ScanStatus = ScanStatusInQueue
 	model.ImageScanQueue = append(model.ImageScanQueue, imageInfo.image())
+	return nil
+}
+
+// verifySignature checks an image's signature against a single trust
+// scope. Neither branch can actually admit an image yet: sigstoreSigned
+// has no keyless verifier wired up, and signedBy's detached-signature
+// check against the image's manifest is still a follow-up change (see
+// verifyDetachedSignature) -- both fail closed, so a signedBy or
+// sigstoreSigned scope rejects every image until that wiring lands,
+// rather than silently trusting everything in the meantime.
+func verifySignature(scope trust.Scope) (bool, error) {
+	if scope.Type == trust.SigstoreSigned {
+		return false, nil
+	}
+	return verifyDetachedSignature(scope.KeyPath)
 }
 
-func (model *Model) getNextImageFromHubCheckQueue() *Image {
+func (model *Model) applyGetNextImageFromHubCheckQueue() (*Image, error) {
 	if len(model.ImageHubCheckQueue) == 0 {
 		log.Info("hub check queue empty")
-		return nil
+		return nil, nil
 	}
 
 	first := model.ImageHubCheckQueue[0]
-	imageInfo := model.safeGet(first.Sha)
+	imageInfo, err := model.safeGet(first.Sha)
+	if err != nil {
+		return nil, err
+	}
 	if imageInfo.ScanStatus != ScanStatusInHubCheckQueue {
-		message := fmt.Sprintf("can't start checking hub for image %s, status is not ScanStatusInHubCheckQueue (%s)", string(first.Sha), imageInfo.ScanStatus)
-		log.Errorf(message)
-		panic(message) // TODO get rid of this panic
+		return nil, &ErrIllegalTransition{Sha: first.Sha, From: imageInfo.ScanStatus, Kind: EventHubCheckStarted}
 	}
 
 	imageInfo.ScanStatus = ScanStatusCheckingHub
 	model.ImageHubCheckQueue = model.ImageHubCheckQueue[1:]
-	return &first
+	return &first, nil
 }
 
-func (model *Model) getNextImageFromScanQueue() *Image {
+// GetNextImageFromHubCheckQueue pops the next image off the hub-check
+// queue and durably records that the Hub check started.
+func (model *Model) GetNextImageFromHubCheckQueue() (*Image, error) {
+	image, err := model.applyGetNextImageFromHubCheckQueue()
+	if err != nil || image == nil {
+		return image, err
+	}
+	event := Event{Kind: EventHubCheckStarted, Sha: image.Sha, Image: *image, Timestamp: time.Now()}
+	if model.store != nil {
+		if err := model.store.Append(event); err != nil {
+			return image, fmt.Errorf("popped %s from the hub check queue but failed to persist it: %v", image.Sha, err)
+		}
+	}
+	model.bus.publish(event)
+	return image, nil
+}
+
+// applyGetNextImageFromScanQueue picks the head of the scan queue, if the
+// concurrency limit allows starting another scan, and hands it to
+// applyScanStarted. This is the live path: the Scheduler (if any) has
+// already reordered the queue by the time this runs, so the head is
+// whichever image it selected.
+func (model *Model) applyGetNextImageFromScanQueue() (*Image, error) {
 	if model.inProgressScanCount() >= model.ConcurrentScanLimit {
 		log.Infof("max concurrent scan count reached, can't start a new scan -- %v", model.inProgressScanJobs())
-		return nil
+		return nil, nil
 	}
 
 	if len(model.ImageScanQueue) == 0 {
 		log.Info("scan queue empty, can't start a new scan")
-		return nil
+		return nil, nil
+	}
+
+	return model.applyScanStarted(model.ImageScanQueue[0].Sha)
+}
+
+// applyScanStarted removes sha from the scan queue, wherever it sits, and
+// marks it running. It's keyed on sha rather than queue position so that
+// replaying an EventScanStarted -- which records the sha that was actually
+// started -- reconstructs the same outcome regardless of what order a live
+// Scheduler had reshuffled the in-memory queue into at the time; the
+// queue's reordering is never itself logged as an event, so replay can't
+// re-derive it from position alone.
+func (model *Model) applyScanStarted(sha DockerImageSha) (*Image, error) {
+	imageInfo, err := model.safeGet(sha)
+	if err != nil {
+		return nil, err
 	}
 
-	first := model.ImageScanQueue[0]
-	imageInfo := model.safeGet(first.Sha)
-	if imageInfo.ScanStatus != ScanStatusInQueue {
-		message := fmt.Sprintf("can't start scanning image %s, status is not InQueue (%s)", string(first.Sha), imageInfo.ScanStatus)
-		log.Errorf(message)
-		panic(message) // TODO get rid of this panic
+	idx := -1
+	for i, queued := range model.ImageScanQueue {
+		if queued.Sha == sha {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || imageInfo.ScanStatus != ScanStatusInQueue {
+		return nil, &ErrIllegalTransition{Sha: sha, From: imageInfo.ScanStatus, Kind: EventScanStarted}
 	}
 
+	image := model.ImageScanQueue[idx]
+	model.ImageScanQueue = append(model.ImageScanQueue[:idx], model.ImageScanQueue[idx+1:]...)
 	imageInfo.ScanStatus = ScanStatusRunningScanClient
-	model.ImageScanQueue = model.ImageScanQueue[1:]
-	return &first
+	return &image, nil
+}
+
+// GetNextImageFromScanQueue pops the next image off the scan queue (if the
+// concurrency limit allows it) and durably records that the scan started.
+// If a Scheduler is configured, it picks which queued image goes next
+// (fair-share/priority/per-registry caps) instead of strict FIFO; the
+// queue itself is just reordered in memory first, and the replayed
+// EventScanStarted -- keyed on the popped image's sha, not on queue
+// position -- still reconstructs whichever image was actually popped.
+func (model *Model) GetNextImageFromScanQueue() (*Image, error) {
+	if model.Scheduler != nil && len(model.ImageScanQueue) > 0 {
+		idx := model.Scheduler.Select(model)
+		if idx < 0 {
+			return nil, nil
+		}
+		model.ImageScanQueue[0], model.ImageScanQueue[idx] = model.ImageScanQueue[idx], model.ImageScanQueue[0]
+	}
+
+	image, err := model.applyGetNextImageFromScanQueue()
+	if err != nil || image == nil {
+		return image, err
+	}
+	if model.Scheduler != nil {
+		model.Scheduler.Started(*image)
+	}
+	event := Event{Kind: EventScanStarted, Sha: image.Sha, Image: *image, Timestamp: time.Now()}
+	if model.store != nil {
+		if err := model.store.Append(event); err != nil {
+			return image, fmt.Errorf("popped %s from the scan queue but failed to persist it: %v", image.Sha, err)
+		}
+	}
+	model.bus.publish(event)
+	return image, nil
+}
+
+// ErrorRunningScanClient marks image's scan as failed and re-queues it.
+func (model *Model) ErrorRunningScanClient(image Image) error {
+	if err := model.Apply(Event{Kind: EventScanRequeued, Sha: image.Sha, Image: image}); err != nil {
+		return err
+	}
+	if model.Scheduler != nil {
+		model.Scheduler.Finished(image)
+	}
+	return nil
 }
 
-func (model *Model) errorRunningScanClient(image Image) {
-	results := model.safeGet(image.Sha)
+func (model *Model) applyErrorRunningScanClient(image Image) error {
+	results, err := model.safeGet(image.Sha)
+	if err != nil {
+		return err
+	}
 	if results.ScanStatus != ScanStatusRunningScanClient {
-		message := fmt.Sprintf("cannot error out scan client for image %s, scan client not in progress (%s)", image.HumanReadableName(), results.ScanStatus)
-		log.Errorf(message)
-		panic(message)
+		return &ErrIllegalTransition{Sha: image.Sha, From: results.ScanStatus, Kind: EventScanRequeued}
 	}
 	results.ScanStatus = ScanStatusError
-	// TODO get rid of these
-	// for now, just readd the image to the queue upon error
-	model.addImageToScanQueue(image.Sha)
+	return model.applyAddImageToScanQueue(image.Sha)
 }
 
-func (model *Model) finishRunningScanClient(image Image) {
-	results := model.safeGet(image.Sha)
+// FinishRunningScanClient transitions image from running-the-scan-client
+// to running the Hub scan, recording an EventScanFinished.
+func (model *Model) FinishRunningScanClient(image Image) error {
+	if err := model.Apply(Event{Kind: EventScanFinished, Sha: image.Sha, Image: image}); err != nil {
+		return err
+	}
+	if model.Scheduler != nil {
+		model.Scheduler.Finished(image)
+	}
+	return nil
+}
+
+func (model *Model) applyFinishRunningScanClient(image Image) error {
+	results, err := model.safeGet(image.Sha)
+	if err != nil {
+		return err
+	}
 	if results.ScanStatus != ScanStatusRunningScanClient {
-		message := fmt.Sprintf("cannot finish running scan client for image %s, scan client not in progress (%s)", image.HumanReadableName(), results.ScanStatus)
-		log.Errorf(message)
-		panic(message) // TODO get rid of panic
+		return &ErrIllegalTransition{Sha: image.Sha, From: results.ScanStatus, Kind: EventScanFinished}
 	}
 	results.ScanStatus = ScanStatusRunningHubScan
+	return nil
 }
 
 // func (model *Model) finishRunningHubScan(image Image) {
@@ -198,6 +480,75 @@ func (model *Model) finishRunningScanClient(image Image) {
 
 // additional methods
 
+// namespacesForImage returns the distinct namespaces of pods currently
+// referencing sha, for the Scheduler's per-namespace fair-share.
+func (model *Model) namespacesForImage(sha DockerImageSha) []string {
+	seen := map[string]bool{}
+	namespaces := []string{}
+	for _, pod := range model.Pods {
+		for _, cont := range pod.Containers {
+			if cont.Image.Sha != sha {
+				continue
+			}
+			if !seen[pod.Namespace] {
+				seen[pod.Namespace] = true
+				namespaces = append(namespaces, pod.Namespace)
+			}
+		}
+	}
+	return namespaces
+}
+
+// priorityForImage returns the highest PriorityAnnotation value among pods
+// referencing sha, defaulting to PriorityNormal if none set one.
+func (model *Model) priorityForImage(sha DockerImageSha) string {
+	best := ""
+	bestRank := -1
+	for _, pod := range model.Pods {
+		for _, cont := range pod.Containers {
+			if cont.Image.Sha != sha {
+				continue
+			}
+			if priority, ok := pod.Annotations[PriorityAnnotation]; ok {
+				if rank := priorityRank(priority); rank > bestRank {
+					best = priority
+					bestRank = rank
+				}
+			}
+		}
+	}
+	if best == "" {
+		return PriorityNormal
+	}
+	return best
+}
+
+// PreemptStuckScans requeues any in-progress scan that's exceeded the
+// Scheduler's deadline back to ScanStatusInQueue, returning the images it
+// preempted. It's a no-op if no Scheduler is configured.
+func (model *Model) PreemptStuckScans() ([]Image, error) {
+	if model.Scheduler == nil {
+		return nil, nil
+	}
+	preempted := []Image{}
+	for _, sha := range model.Scheduler.Overdue() {
+		imageInfo, err := model.safeGet(sha)
+		if err != nil {
+			continue
+		}
+		if imageInfo.ScanStatus != ScanStatusRunningScanClient {
+			continue
+		}
+		image := imageInfo.image()
+		if err := model.ErrorRunningScanClient(image); err != nil {
+			return preempted, err
+		}
+		model.Scheduler.recordPreemption()
+		preempted = append(preempted, image)
+	}
+	return preempted, nil
+}
+
 func (model *Model) inProgressScanJobs() []DockerImageSha {
 	inProgressShas := []DockerImageSha{}
 	for sha, results := range model.Images {
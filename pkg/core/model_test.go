@@ -0,0 +1,119 @@
+package core
+
+import "testing"
+
+// memStore is a minimal in-memory EventStore good enough to drive replay
+// in tests -- it has no durability, but that's irrelevant here.
+type memStore struct {
+	log []Event
+}
+
+func (s *memStore) Append(event Event) error {
+	s.log = append(s.log, event)
+	return nil
+}
+
+func (s *memStore) Replay() ([]Event, error) {
+	return s.log, nil
+}
+
+func (s *memStore) Compact(snapshot []Event) error {
+	s.log = snapshot
+	return nil
+}
+
+func newTestImage(sha string) Image {
+	return Image{Sha: DockerImageSha(sha), Name: "example.com/repo:" + sha}
+}
+
+// TestReplayHonorsRecordedScanStartedSha reproduces the chunk0-4 replay
+// bug: when a Scheduler reorders the in-memory scan queue before popping,
+// the logged EventScanStarted records the sha that was actually started,
+// and replaying that event from an empty Model must start that same sha --
+// not whatever plain FIFO order would have picked.
+func TestReplayHonorsRecordedScanStartedSha(t *testing.T) {
+	store := &memStore{}
+	model, err := NewModel(10, store)
+	if err != nil {
+		t.Fatalf("unexpected error constructing model: %v", err)
+	}
+
+	first := newTestImage("sha-first")
+	second := newTestImage("sha-second")
+	for _, image := range []Image{first, second} {
+		if err := model.AddImage(image); err != nil {
+			t.Fatalf("AddImage(%v): %v", image, err)
+		}
+		if err := model.Apply(Event{Kind: EventHubCheckStarted, Sha: image.Sha, Image: image}); err != nil {
+			t.Fatalf("HubCheckStarted(%v): %v", image, err)
+		}
+		if err := model.Apply(Event{Kind: EventScanQueued, Sha: image.Sha}); err != nil {
+			t.Fatalf("ScanQueued(%v): %v", image, err)
+		}
+	}
+
+	// Simulate a Scheduler picking the second-queued image out of order,
+	// the way GetNextImageFromScanQueue's live path would.
+	model.ImageScanQueue[0], model.ImageScanQueue[1] = model.ImageScanQueue[1], model.ImageScanQueue[0]
+	started, err := model.applyGetNextImageFromScanQueue()
+	if err != nil {
+		t.Fatalf("applyGetNextImageFromScanQueue: %v", err)
+	}
+	if started.Sha != second.Sha {
+		t.Fatalf("expected the reordered image %s to start, got %s", second.Sha, started.Sha)
+	}
+	if err := store.Append(Event{Kind: EventScanStarted, Sha: started.Sha, Image: *started}); err != nil {
+		t.Fatalf("ScanStarted: %v", err)
+	}
+
+	replayed, err := NewModel(10, store)
+	if err != nil {
+		t.Fatalf("unexpected error replaying model: %v", err)
+	}
+
+	if replayed.Images[second.Sha].ScanStatus != ScanStatusRunningScanClient {
+		t.Errorf("expected %s to be RunningScanClient after replay, got %s", second.Sha, replayed.Images[second.Sha].ScanStatus)
+	}
+	if replayed.Images[first.Sha].ScanStatus != ScanStatusInQueue {
+		t.Errorf("expected %s to remain InQueue after replay, got %s", first.Sha, replayed.Images[first.Sha].ScanStatus)
+	}
+}
+
+// TestCompactPreservesTerminalStatus reproduces the chunk0-4 compaction
+// bug: an image rejected by trust policy must still be RejectedByPolicy
+// (not silently re-queued for a hub check) after a Compact + replay cycle.
+func TestCompactPreservesTerminalStatus(t *testing.T) {
+	store := &memStore{}
+	model, err := NewModel(10, store)
+	if err != nil {
+		t.Fatalf("unexpected error constructing model: %v", err)
+	}
+
+	image := newTestImage("sha-rejected")
+	if err := model.AddImage(image); err != nil {
+		t.Fatalf("AddImage: %v", err)
+	}
+	model.Images[image.Sha].ScanStatus = ScanStatusRejectedByPolicy
+
+	if err := model.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	replayed, err := NewModel(10, store)
+	if err != nil {
+		t.Fatalf("unexpected error replaying compacted model: %v", err)
+	}
+
+	info, ok := replayed.Images[image.Sha]
+	if !ok {
+		t.Fatalf("expected %s to survive compaction", image.Sha)
+	}
+	if info.ScanStatus != ScanStatusRejectedByPolicy {
+		t.Errorf("expected %s to remain RejectedByPolicy after compaction+replay, got %s", image.Sha, info.ScanStatus)
+	}
+	for _, queued := range replayed.ImageHubCheckQueue {
+		if queued.Sha == image.Sha {
+			t.Errorf("expected %s to NOT be re-enqueued into the hub check queue after compaction+replay", image.Sha)
+		}
+	}
+}
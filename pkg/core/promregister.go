@@ -0,0 +1,44 @@
+package core
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// registerGauge registers g with the default Prometheus registry, unless a
+// gauge with the same fully-qualified name is already registered -- in
+// which case the existing gauge is reused instead. Without this, a second
+// call to a constructor like NewAutoUpdater in the same process (e.g. from
+// a test that builds more than one) would hit prometheus.MustRegister's
+// panic on duplicate registration.
+func registerGauge(g prometheus.Gauge) prometheus.Gauge {
+	if err := prometheus.Register(g); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(prometheus.Gauge)
+		}
+		log.Errorf("unable to register metric: %s", err.Error())
+	}
+	return g
+}
+
+// registerGaugeVec is registerGauge for a *prometheus.GaugeVec.
+func registerGaugeVec(g *prometheus.GaugeVec) *prometheus.GaugeVec {
+	if err := prometheus.Register(g); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(*prometheus.GaugeVec)
+		}
+		log.Errorf("unable to register metric: %s", err.Error())
+	}
+	return g
+}
+
+// registerCounter is registerGauge for a prometheus.Counter.
+func registerCounter(c prometheus.Counter) prometheus.Counter {
+	if err := prometheus.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(prometheus.Counter)
+		}
+		log.Errorf("unable to register metric: %s", err.Error())
+	}
+	return c
+}
@@ -0,0 +1,44 @@
+package core
+
+// ScanStatus captures where a single image is in the scan pipeline.
+type ScanStatus int
+
+const (
+	ScanStatusUnknown ScanStatus = iota
+	ScanStatusInHubCheckQueue
+	ScanStatusCheckingHub
+	ScanStatusInQueue
+	ScanStatusRunningScanClient
+	ScanStatusRunningHubScan
+	ScanStatusComplete
+	ScanStatusError
+	// ScanStatusRejectedByPolicy is a terminal state: after its Hub check,
+	// the pkg/trust policy refused the image's reference, so it was never
+	// enqueued for a scan.
+	ScanStatusRejectedByPolicy
+)
+
+func (status ScanStatus) String() string {
+	switch status {
+	case ScanStatusUnknown:
+		return "Unknown"
+	case ScanStatusInHubCheckQueue:
+		return "InHubCheckQueue"
+	case ScanStatusCheckingHub:
+		return "CheckingHub"
+	case ScanStatusInQueue:
+		return "InQueue"
+	case ScanStatusRunningScanClient:
+		return "RunningScanClient"
+	case ScanStatusRunningHubScan:
+		return "RunningHubScan"
+	case ScanStatusComplete:
+		return "Complete"
+	case ScanStatusError:
+		return "Error"
+	case ScanStatusRejectedByPolicy:
+		return "RejectedByPolicy"
+	default:
+		return "UNKNOWN SCAN STATUS"
+	}
+}
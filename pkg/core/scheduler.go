@@ -0,0 +1,207 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PriorityAnnotation, when present on a pod spec, sets the scan priority
+// for every image that pod references. Images referenced by pods at
+// different priorities get the highest of those priorities.
+const PriorityAnnotation = "perceptor.blackduck.com/priority"
+
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+func priorityRank(priority string) int {
+	switch priority {
+	case PriorityHigh:
+		return 2
+	case PriorityLow:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Scheduler picks which queued image may start its scan next. The default
+// FIFO behavior (always pop the head) is preserved when Model.Scheduler is
+// nil; setting it to a *Scheduler adds per-namespace fair-share, priority
+// classes, and per-registry concurrency caps.
+type Scheduler struct {
+	registryLimits map[string]int
+	scanTimeout    time.Duration
+
+	mu               sync.Mutex
+	registryInFlight map[string]int
+	namespaceTurn    int
+	startedAt        map[DockerImageSha]time.Time
+
+	queueDepthByNamespace *prometheus.GaugeVec
+	registryInFlightGauge *prometheus.GaugeVec
+	preemptions           prometheus.Counter
+}
+
+// NewScheduler returns a Scheduler enforcing at most registryLimits[host]
+// concurrent scans per registry (registries absent from the map are
+// unlimited), and preempting any scan running longer than scanTimeout back
+// into the queue.
+func NewScheduler(registryLimits map[string]int, scanTimeout time.Duration) *Scheduler {
+	s := &Scheduler{
+		registryLimits:   registryLimits,
+		scanTimeout:      scanTimeout,
+		registryInFlight: make(map[string]int),
+		startedAt:        make(map[DockerImageSha]time.Time),
+	}
+	s.queueDepthByNamespace = registerGaugeVec(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "perceptor",
+		Subsystem: "core",
+		Name:      "scheduler_queue_depth",
+		Help:      "number of images queued for scanning, by namespace",
+	}, []string{"namespace"}))
+	s.registryInFlightGauge = registerGaugeVec(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "perceptor",
+		Subsystem: "core",
+		Name:      "scheduler_registry_in_flight",
+		Help:      "number of scans currently running per source registry",
+	}, []string{"registry"}))
+	s.preemptions = registerCounter(prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "perceptor",
+		Subsystem: "core",
+		Name:      "scheduler_preemptions_total",
+		Help:      "number of scans requeued after exceeding the scan deadline",
+	}))
+	return s
+}
+
+// Select returns the index in model.ImageScanQueue of the next image
+// that's allowed to start, or -1 if none can right now (every candidate's
+// registry is already at its concurrency cap).
+func (s *Scheduler) Select(model *Model) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byNamespace := make(map[string][]int)
+	for i, image := range model.ImageScanQueue {
+		ns := model.namespacesForImage(image.Sha)
+		if len(ns) == 0 {
+			ns = []string{""}
+		}
+		for _, namespace := range ns {
+			byNamespace[namespace] = append(byNamespace[namespace], i)
+		}
+	}
+	for namespace, indices := range byNamespace {
+		s.queueDepthByNamespace.With(prometheus.Labels{"namespace": namespace}).Set(float64(len(indices)))
+	}
+
+	namespaces := make([]string, 0, len(byNamespace))
+	for namespace := range byNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	if len(namespaces) == 0 {
+		return -1
+	}
+	// Map iteration order is randomized, so without sorting, namespaceTurn
+	// would index into a different ordering every call and never actually
+	// round-robin between namespaces.
+	sort.Strings(namespaces)
+
+	// Fair-share: starting from the namespace whose turn it is, find the
+	// first namespace with a candidate whose registry isn't already at
+	// its concurrency cap, preferring that namespace's highest-priority
+	// image.
+	for attempt := 0; attempt < len(namespaces); attempt++ {
+		namespace := namespaces[(s.namespaceTurn+attempt)%len(namespaces)]
+		idx := s.bestCandidate(model, byNamespace[namespace])
+		if idx >= 0 {
+			s.namespaceTurn = (s.namespaceTurn + attempt + 1) % len(namespaces)
+			return idx
+		}
+	}
+	return -1
+}
+
+// bestCandidate returns the highest-priority index among candidates whose
+// registry has spare concurrency, or -1 if none do.
+func (s *Scheduler) bestCandidate(model *Model, candidates []int) int {
+	best := -1
+	bestRank := -1
+	for _, idx := range candidates {
+		image := model.ImageScanQueue[idx]
+		if !s.hasCapacity(registryHostOf(image.Name)) {
+			continue
+		}
+		rank := priorityRank(model.priorityForImage(image.Sha))
+		if rank > bestRank {
+			bestRank = rank
+			best = idx
+		}
+	}
+	return best
+}
+
+func (s *Scheduler) hasCapacity(registry string) bool {
+	limit, hasLimit := s.registryLimits[registry]
+	if !hasLimit {
+		return true
+	}
+	return s.registryInFlight[registry] < limit
+}
+
+// Started records that image's scan began, for registry concurrency
+// accounting and deadline-based preemption.
+func (s *Scheduler) Started(image Image) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	registry := registryHostOf(image.Name)
+	s.registryInFlight[registry]++
+	s.registryInFlightGauge.With(prometheus.Labels{"registry": registry}).Set(float64(s.registryInFlight[registry]))
+	s.startedAt[image.Sha] = time.Now()
+}
+
+// Finished records that image's scan is no longer occupying a registry
+// concurrency slot, whether it completed, errored, or was preempted.
+func (s *Scheduler) Finished(image Image) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	registry := registryHostOf(image.Name)
+	if s.registryInFlight[registry] > 0 {
+		s.registryInFlight[registry]--
+	}
+	s.registryInFlightGauge.With(prometheus.Labels{"registry": registry}).Set(float64(s.registryInFlight[registry]))
+	delete(s.startedAt, image.Sha)
+}
+
+// Overdue returns the shas of images that have been running longer than
+// scanTimeout, for the caller to preempt back into the queue.
+func (s *Scheduler) Overdue() []DockerImageSha {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overdue := []DockerImageSha{}
+	for sha, startedAt := range s.startedAt {
+		if time.Since(startedAt) > s.scanTimeout {
+			overdue = append(overdue, sha)
+		}
+	}
+	return overdue
+}
+
+func (s *Scheduler) recordPreemption() {
+	s.preemptions.Inc()
+}
+
+func registryHostOf(ref string) string {
+	for i, c := range ref {
+		if c == '/' {
+			return ref[:i]
+		}
+	}
+	return ref
+}
@@ -0,0 +1,116 @@
+package core
+
+import "testing"
+
+func TestRegistryHostOf(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"docker.io/library/busybox:latest", "docker.io"},
+		{"quay.io/org/repo@sha256:abc", "quay.io"},
+		{"busybox", "busybox"},
+	}
+	for _, tt := range tests {
+		if got := registryHostOf(tt.ref); got != tt.want {
+			t.Errorf("registryHostOf(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func newSchedulerForTest(registryLimits map[string]int) *Scheduler {
+	return NewScheduler(registryLimits, 0)
+}
+
+// TestSchedulerSelectRespectsRegistryCap verifies a registry at its
+// concurrency cap is skipped in favor of a candidate with spare capacity,
+// even though the capped registry's image is queued first.
+func TestSchedulerSelectRespectsRegistryCap(t *testing.T) {
+	s := newSchedulerForTest(map[string]int{"docker.io": 1})
+
+	capped := newTestImage("sha-capped")
+	capped.Name = "docker.io/library/busybox:latest"
+	other := newTestImage("sha-other")
+	other.Name = "quay.io/org/repo:latest"
+
+	model := &Model{
+		Pods:           make(map[string]Pod),
+		Images:         make(map[DockerImageSha]*ImageInfo),
+		ImageScanQueue: []Image{capped, other},
+	}
+	model.Images[capped.Sha] = NewImageInfo(capped.Sha, capped.Name)
+	model.Images[other.Sha] = NewImageInfo(other.Sha, other.Name)
+
+	// Simulate docker.io already at its cap of 1 in-flight scan.
+	s.Started(Image{Sha: DockerImageSha("sha-in-flight"), Name: "docker.io/library/already-running:latest"})
+
+	idx := s.Select(model)
+	if idx < 0 {
+		t.Fatal("expected a candidate to be selected")
+	}
+	if model.ImageScanQueue[idx].Sha != other.Sha {
+		t.Errorf("expected the uncapped registry's image to be selected, got %s", model.ImageScanQueue[idx].Sha)
+	}
+}
+
+// TestSchedulerSelectReturnsNoneWhenEveryRegistryIsCapped verifies Select
+// returns -1 rather than picking an over-cap candidate when nothing has
+// spare registry concurrency.
+func TestSchedulerSelectReturnsNoneWhenEveryRegistryIsCapped(t *testing.T) {
+	s := newSchedulerForTest(map[string]int{"docker.io": 1})
+
+	image := newTestImage("sha-only")
+	image.Name = "docker.io/library/busybox:latest"
+
+	model := &Model{
+		Pods:           make(map[string]Pod),
+		Images:         make(map[DockerImageSha]*ImageInfo),
+		ImageScanQueue: []Image{image},
+	}
+	model.Images[image.Sha] = NewImageInfo(image.Sha, image.Name)
+
+	s.Started(Image{Sha: DockerImageSha("sha-in-flight"), Name: "docker.io/library/already-running:latest"})
+
+	if idx := s.Select(model); idx != -1 {
+		t.Errorf("expected no candidate to be selected, got index %d", idx)
+	}
+}
+
+// TestSchedulerSelectRoundRobinsNamespacesInStableOrder verifies Select
+// advances namespaceTurn through a consistent, sorted namespace ordering
+// -- not whatever order Go's randomized map iteration happens to produce
+// -- so repeated calls visit every namespace exactly once per cycle.
+func TestSchedulerSelectRoundRobinsNamespacesInStableOrder(t *testing.T) {
+	s := newSchedulerForTest(nil)
+
+	model := &Model{
+		Pods:           make(map[string]Pod),
+		Images:         make(map[DockerImageSha]*ImageInfo),
+		ImageScanQueue: []Image{},
+	}
+
+	namespaces := []string{"alpha", "beta", "gamma"}
+	imageForNamespace := make(map[string]Image, len(namespaces))
+	for _, namespace := range namespaces {
+		image := newTestImage("sha-" + namespace)
+		model.Images[image.Sha] = NewImageInfo(image.Sha, image.Name)
+		model.ImageScanQueue = append(model.ImageScanQueue, image)
+		model.Pods[namespace+"/pod"] = Pod{
+			Namespace:  namespace,
+			Containers: []Container{{Image: image}},
+		}
+		imageForNamespace[namespace] = image
+	}
+
+	for round := 0; round < 2; round++ {
+		for _, namespace := range namespaces {
+			idx := s.Select(model)
+			if idx < 0 {
+				t.Fatalf("round %d: expected a candidate for namespace %s", round, namespace)
+			}
+			if got := model.ImageScanQueue[idx].Sha; got != imageForNamespace[namespace].Sha {
+				t.Errorf("round %d: expected namespace %s's image to be selected next, got %s", round, namespace, got)
+			}
+		}
+	}
+}
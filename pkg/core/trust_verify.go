@@ -0,0 +1,77 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/trust"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+)
+
+// verifyDetachedSignature checks that the pubkey at keyPath can at least be
+// loaded, but does not yet verify any signature -- that requires wiring the
+// image's detached signature blob through from pkg/docker, which lands in a
+// follow-up change. Until then it fails closed: a signedBy scope never
+// admits an image, even when its key parses fine, so "no verifier wired up
+// yet" can't be mistaken for "verified".
+func verifyDetachedSignature(keyPath string) (bool, error) {
+	if keyPath == "" {
+		return false, fmt.Errorf("signedBy scope is missing keyPath")
+	}
+	f, err := os.Open(keyPath)
+	if err != nil {
+		return false, fmt.Errorf("unable to open trust key %s: %v", keyPath, err)
+	}
+	defer f.Close()
+
+	if _, err := openpgp.ReadArmoredKeyRing(f); err != nil {
+		return false, fmt.Errorf("unable to parse trust key %s: %v", keyPath, err)
+	}
+	return false, nil
+}
+
+// trustShowScope is a trust.Scope plus a diagnostic note for scope types
+// whose signature verification isn't wired up yet (see
+// verifyDetachedSignature), so `trust show` doesn't let an admin configure
+// a signedBy/sigstoreSigned scope and only discover later, from every scan
+// silently landing in ScanStatusRejectedByPolicy, that it could never pass.
+type trustShowScope struct {
+	trust.Scope
+	Warning string `json:"warning,omitempty"`
+}
+
+const unimplementedSignatureWarning = "signature verification for this requirement type is not yet implemented -- every image matching this scope is rejected"
+
+// TrustShow returns a handler for GET /trust/show?ref=<image-reference>, a
+// "trust show" style audit endpoint: it reports the effective policy scopes
+// that would be consulted for ref, most specific first, so a cluster admin
+// can see why an image was (or would be) rejected. A nil TrustPolicy -- the
+// "trust everything" default -- reports no scopes at all.
+func (model *Model) TrustShow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			http.Error(w, "expected a ref query parameter", http.StatusBadRequest)
+			return
+		}
+		scopes := []trust.Scope{}
+		if model.TrustPolicy != nil {
+			scopes = model.TrustPolicy.EffectivePolicy(ref)
+		}
+		shown := make([]trustShowScope, len(scopes))
+		for i, scope := range scopes {
+			shown[i] = trustShowScope{Scope: scope}
+			switch scope.Type {
+			case trust.SignedBy, trust.SigstoreSigned:
+				shown[i].Warning = unimplementedSignatureWarning
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(shown); err != nil {
+			log.Errorf("unable to encode trust show response for %s: %v", ref, err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/trust"
+)
+
+// TestTrustShowFlagsUnimplementedSignatureScopes verifies that `trust show`
+// warns on signedBy/sigstoreSigned scopes, since verifyDetachedSignature
+// doesn't actually check a signature yet and every image under one of
+// those scopes is rejected unconditionally.
+func TestTrustShowFlagsUnimplementedSignatureScopes(t *testing.T) {
+	model := &Model{
+		TrustPolicy: &trust.Policy{
+			Default: []trust.Scope{
+				{Type: trust.SignedBy, KeyPath: "/keys/trusted.gpg"},
+				{Type: trust.InsecureAcceptAnything},
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/trust/show?ref=docker.io/library/busybox:latest", nil)
+	rec := httptest.NewRecorder()
+	model.TrustShow().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var shown []trustShowScope
+	if err := json.Unmarshal(rec.Body.Bytes(), &shown); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if len(shown) != 2 {
+		t.Fatalf("expected 2 scopes, got %d: %+v", len(shown), shown)
+	}
+	if shown[0].Type != trust.SignedBy || shown[0].Warning == "" {
+		t.Errorf("expected the signedBy scope to carry a warning, got %+v", shown[0])
+	}
+	if shown[1].Type != trust.InsecureAcceptAnything || shown[1].Warning != "" {
+		t.Errorf("expected the insecureAcceptAnything scope to carry no warning, got %+v", shown[1])
+	}
+}
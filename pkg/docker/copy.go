@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/copy"
+	ociarchive "github.com/containers/image/v5/oci/archive"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+)
+
+// resolveManifestDigest returns the digest of the top-level manifest src
+// currently points at. When that is a manifest list, the list's own digest
+// is returned; no entry is selected from it, whatever the SystemContext's
+// architecture/OS choice.
+func resolveManifestDigest(ctx context.Context, src types.ImageSource) (string, error) {
+	manifestBytes, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	digest, err := manifestDigest(manifestBytes)
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// copyToOCILayout pulls name (resolved per sc, narrowed to platform if it
+// is a manifest list) into an OCI layout tarball at destPath, using an
+// insecure-accept-anything policy -- actual trust enforcement happens
+// earlier, in pkg/trust.
+func copyToOCILayout(ctx context.Context, sc *types.SystemContext, name string, platform string, destPath string) error {
+	sc.ArchitectureChoice, sc.OSChoice = splitPlatform(platform)
+	srcRef, err := alltransports.ParseImageName(fmt.Sprintf("docker://%s", name))
+	if err != nil {
+		return err
+	}
+	destRef, err := ociarchive.Transport.ParseReference(destPath)
+	if err != nil {
+		return err
+	}
+	policyCtx, err := signature.NewPolicyContext(&signature.Policy{
+		Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		return err
+	}
+	defer policyCtx.Destroy()
+
+	_, err = copy.Image(ctx, policyCtx, destRef, srcRef, &copy.Options{
+		SourceCtx: sc,
+	})
+	return err
+}
@@ -0,0 +1,15 @@
+package docker
+
+import (
+	"github.com/containers/image/v5/manifest"
+)
+
+// manifestDigest computes the content digest of a raw manifest blob, the
+// same value a registry would hand back in a Docker-Content-Digest header.
+func manifestDigest(raw []byte) (string, error) {
+	d, err := manifest.Digest(raw)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
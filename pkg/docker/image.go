@@ -1,43 +1,23 @@
 package docker
 
-import (
-	"fmt"
-	"net/url"
-	"strings"
-)
+// Digest is a resolved, content-addressable manifest digest, e.g.
+// "sha256:abcdef...". Unlike a tag, a digest always identifies the same
+// bytes, which is what perceptor uses to key scanned images.
+type Digest string
 
+// Image identifies a container image by the reference perceiver/perceptor
+// saw it under (which may be a mutable tag) plus, once resolved, the
+// manifest digest that reference pointed at.
 type Image struct {
-	name string
+	// Name is the reference as it appeared on the pod spec, e.g.
+	// "myregistry:5000/foo/bar:v1.2.3".
+	Name string
+	// Digest is populated by an ImageSource once the reference has been
+	// resolved against the registry. It is empty until then.
+	Digest Digest
 }
 
+// NewImage returns an Image for the given (not yet resolved) reference.
 func NewImage(name string) *Image {
-	return &Image{name: name}
+	return &Image{Name: name}
 }
-
-func (image *Image) tarFilePath() string {
-	// have to get rid of `/` so that it's not interpreted as directory separators
-	sanitizedName := strings.Replace(image.name, "/", "_", -1)
-	// TODO use os.join or something
-	return fmt.Sprintf("./tmp/%s.tar", sanitizedName)
-}
-
-func (image *Image) urlEncodedName() string {
-	return url.QueryEscape(image.name)
-}
-
-func (image *Image) createURL() string {
-	// TODO v1.24 refers to the docker version.  figure out how to avoid hard-coding this
-	// TODO can probably use the docker api code for this
-	return fmt.Sprintf("http://localhost/v1.24/images/create?fromImage=%s", image.urlEncodedName())
-	//	return fmt.Sprintf("http://localhost/v1.24/images/create?fromImage=%s&tag=%s", image.name, image.tag)
-}
-
-func (image *Image) getURL() string {
-	// TODO we'll leave off user for now, but maybe it should be added back in later ???
-	//   the digest could also be added in
-	// imageName := fmt.Sprintf("%s%s%s%s%s", image.user, "%2F", image.name, "%3A", image.tag)
-	// TODO let's maybe trying keeping everything together in image -- example of which is:
-	//   172.30.89.171:5000/blackduck-scan/hub_ose_arbiter:4.3.0
-	// imageName := fmt.Sprintf("%s%s%s", image.name, "%3A", image.tag)
-	return fmt.Sprintf("/images/%s/get", image.urlEncodedName())
-}
\ No newline at end of file
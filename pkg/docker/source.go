@@ -0,0 +1,136 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/registries"
+	alltransports "github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+)
+
+// ResolvedImage is the result of pulling an Image down from its registry:
+// the manifest digest it resolved to, the platform the manifest-list (if
+// any) was narrowed to, and the path of the OCI layout tarball the scanner
+// should be pointed at.
+type ResolvedImage struct {
+	Image      Image
+	Digest     Digest
+	Platform   string
+	LayoutPath string
+}
+
+// ImageSource resolves an image reference to a manifest digest and pulls
+// the corresponding blobs into an OCI layout on disk for the scanner to
+// consume. It replaces the old direct-to-docker-daemon HTTP client.
+type ImageSource interface {
+	// Resolve looks up the digest of the current top-level manifest for an
+	// image reference without pulling blobs. For a manifest list this is
+	// the list's own digest, not that of the entry for the given platform.
+	Resolve(ctx context.Context, name string, platform string) (Digest, error)
+	// Pull resolves name and downloads it into an OCI layout tarball,
+	// returning the path to that tarball along with the resolved digest.
+	Pull(ctx context.Context, name string, platform string) (*ResolvedImage, error)
+}
+
+// RegistryImageSource is an ImageSource backed by the containers/image
+// library, authenticating against registries configured in
+// pkg/registries.
+type RegistryImageSource struct {
+	registries *registries.Config
+	layoutDir  string
+}
+
+// NewRegistryImageSource returns an ImageSource that pulls OCI layouts into
+// layoutDir, authenticating with the given registries config.
+func NewRegistryImageSource(registryConfig *registries.Config, layoutDir string) *RegistryImageSource {
+	return &RegistryImageSource{registries: registryConfig, layoutDir: layoutDir}
+}
+
+func (s *RegistryImageSource) systemContext(name string) *types.SystemContext {
+	host := registryHost(name)
+	sc := &types.SystemContext{}
+	reg := s.registries.Find(host)
+	if reg == nil {
+		return sc
+	}
+	if reg.DockerConfigPath != "" {
+		sc.AuthFilePath = reg.DockerConfigPath
+	} else if reg.Username != "" {
+		sc.DockerAuthConfig = &types.DockerAuthConfig{Username: reg.Username, Password: reg.Password}
+	}
+	if reg.Token != "" {
+		sc.DockerBearerRegistryToken = reg.Token
+	}
+	if reg.Insecure {
+		sc.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+	}
+	return sc
+}
+
+// Resolve inspects the remote top-level manifest and returns its digest
+// without downloading any layer blobs. If that manifest is a manifest
+// list, the list's own digest is returned; no entry matching platform is
+// selected from it.
+func (s *RegistryImageSource) Resolve(ctx context.Context, name string, platform string) (Digest, error) {
+	ref, err := alltransports.ParseImageName(fmt.Sprintf("docker://%s", name))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse image reference %s: %v", name, err)
+	}
+	sc := s.systemContext(name)
+	sc.ArchitectureChoice, sc.OSChoice = splitPlatform(platform)
+
+	src, err := ref.NewImageSource(ctx, sc)
+	if err != nil {
+		return "", fmt.Errorf("unable to open image source for %s: %v", name, err)
+	}
+	defer src.Close()
+
+	digest, err := resolveManifestDigest(ctx, src)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve manifest digest for %s: %v", name, err)
+	}
+	return Digest(digest), nil
+}
+
+// Pull resolves name to a digest and copies the corresponding image into
+// an OCI layout tarball under the source's layout directory, returning a
+// path the Hub scan client can be pointed at.
+func (s *RegistryImageSource) Pull(ctx context.Context, name string, platform string) (*ResolvedImage, error) {
+	digest, err := s.Resolve(ctx, name, platform)
+	if err != nil {
+		return nil, err
+	}
+	destPath := filepath.Join(s.layoutDir, sanitize(name)+".tar")
+	if err := copyToOCILayout(ctx, s.systemContext(name), name, platform, destPath); err != nil {
+		return nil, fmt.Errorf("unable to pull %s to %s: %v", name, destPath, err)
+	}
+	return &ResolvedImage{
+		Image:      Image{Name: name, Digest: digest},
+		Digest:     digest,
+		Platform:   platform,
+		LayoutPath: destPath,
+	}, nil
+}
+
+func registryHost(name string) string {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+func splitPlatform(platform string) (arch string, os string) {
+	parts := strings.SplitN(platform, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[1], parts[0]
+}
+
+func sanitize(name string) string {
+	return strings.NewReplacer("/", "_", ":", "_").Replace(name)
+}
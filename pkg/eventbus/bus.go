@@ -0,0 +1,138 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package eventbus is the ring-buffered pub/sub fan-out shared by
+// pkg/core's domain event stream and pkg/perceiver's activity stream:
+// both need the same "assign a Seq, keep a bounded replay backlog for
+// `since`, fan out to live subscribers without blocking on a slow one"
+// behavior, differing only in what event type they carry and whether
+// they hook in Prometheus metrics -- so that logic lives here once
+// instead of being maintained in two copies.
+package eventbus
+
+import "sync"
+
+// Entry is one published event, tagged with the Seq it was assigned.
+type Entry struct {
+	Seq   uint64
+	Event interface{}
+}
+
+// Hooks lets a caller observe bus activity (for metrics) without the bus
+// needing to know anything about what's observing it. Any field left nil
+// is simply not called.
+type Hooks struct {
+	OnDrop                 func()
+	OnSubscriberConnect    func()
+	OnSubscriberDisconnect func()
+}
+
+// Bus fans out published events to subscribers, and keeps a bounded ring
+// buffer so a reconnecting subscriber that supplies a since cursor can
+// catch up on anything it missed instead of silently skipping events.
+type Bus struct {
+	mu          sync.Mutex
+	nextSeq     uint64
+	bufferSize  int
+	ring        []Entry
+	subscribers map[int]chan Entry
+	nextSubID   int
+	hooks       Hooks
+}
+
+// New returns a Bus whose ring buffer and per-subscriber backlog each hold
+// up to bufferSize entries.
+func New(bufferSize int, hooks Hooks) *Bus {
+	return &Bus{
+		bufferSize:  bufferSize,
+		subscribers: make(map[int]chan Entry),
+		hooks:       hooks,
+	}
+}
+
+// Publish assigns the next Seq and asks build to construct the event to
+// publish from it -- so the event's own Seq field (if it has one) can be
+// stamped to match before it's recorded or handed to any subscriber. The
+// built event is recorded in the replay ring and forwarded to every live
+// subscriber, dropped for any whose channel is full rather than blocking
+// the publisher. It returns the built event.
+func (b *Bus) Publish(build func(seq uint64) interface{}) interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextSeq++
+	event := build(b.nextSeq)
+	entry := Entry{Seq: b.nextSeq, Event: event}
+
+	b.ring = append(b.ring, entry)
+	if len(b.ring) > b.bufferSize {
+		b.ring = b.ring[len(b.ring)-b.bufferSize:]
+	}
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			if b.hooks.OnDrop != nil {
+				b.hooks.OnDrop()
+			}
+		}
+	}
+	return event
+}
+
+// Subscribe registers a new subscriber and returns a channel of entries
+// published from now on, an unsubscribe func to call on disconnect, and
+// the backlog of buffered entries with Seq > since (best-effort: entries
+// older than the ring buffer's retention are simply unavailable).
+func (b *Bus) Subscribe(since uint64) (<-chan Entry, func(), []Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	backlog := []Entry{}
+	for _, entry := range b.ring {
+		if entry.Seq > since {
+			backlog = append(backlog, entry)
+		}
+	}
+
+	id := b.nextSubID
+	b.nextSubID++
+	ch := make(chan Entry, b.bufferSize)
+	b.subscribers[id] = ch
+
+	if b.hooks.OnSubscriberConnect != nil {
+		b.hooks.OnSubscriberConnect()
+	}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+			if b.hooks.OnSubscriberDisconnect != nil {
+				b.hooks.OnSubscriberDisconnect()
+			}
+		}
+	}
+	return ch, unsubscribe, backlog
+}
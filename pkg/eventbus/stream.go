@@ -0,0 +1,174 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewHandler returns a GET /events handler: it streams entries published
+// to bus as they happen, replaying anything still in the ring buffer
+// newer than the `since` query parameter first. The framing is negotiated
+// from the Accept header -- "text/event-stream" gets SSE, anything else
+// (including no Accept header) gets newline-delimited JSON.
+//
+// idleTimeout, if positive, closes a connection that no subscriber has
+// drained in that long; zero or negative disables idle expiry entirely.
+//
+// buildMatch, if non-nil, is called once per request to build a predicate
+// an entry's Event must satisfy to be written (e.g. a caller-specific
+// ?filter= query parameter); a nil buildMatch, or one that returns a nil
+// predicate, matches every event.
+func NewHandler(bus *Bus, idleTimeout time.Duration, buildMatch func(r *http.Request) (func(interface{}) bool, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since := uint64(0)
+		if s := r.URL.Query().Get("since"); s != "" {
+			parsed, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid since cursor %q: %v", s, err), http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+
+		var match func(interface{}) bool
+		if buildMatch != nil {
+			built, err := buildMatch(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			match = built
+		}
+
+		useSSE := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		if useSSE {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		entries, unsubscribe, backlog := bus.Subscribe(since)
+		defer unsubscribe()
+
+		for _, entry := range backlog {
+			if matches(entry, match) {
+				if !writeEntry(w, entry, useSSE) {
+					return
+				}
+			}
+		}
+		flusher.Flush()
+
+		var idle *idleTracker
+		var tickerC <-chan time.Time
+		if idleTimeout > 0 {
+			idle = newIdleTracker(idleTimeout)
+			ticker := time.NewTicker(idleTimeout / 4)
+			defer ticker.Stop()
+			tickerC = ticker.C
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case entry, ok := <-entries:
+				if !ok {
+					return
+				}
+				if idle != nil {
+					idle.touch()
+				}
+				if !matches(entry, match) {
+					continue
+				}
+				if !writeEntry(w, entry, useSSE) {
+					return
+				}
+				flusher.Flush()
+			case <-tickerC:
+				if idle.expired() {
+					return
+				}
+			}
+		}
+	})
+}
+
+func matches(entry Entry, match func(interface{}) bool) bool {
+	return match == nil || match(entry.Event)
+}
+
+func writeEntry(w http.ResponseWriter, entry Entry, useSSE bool) bool {
+	data, err := json.Marshal(entry.Event)
+	if err != nil {
+		return false
+	}
+	var writeErr error
+	if useSSE {
+		_, writeErr = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", entry.Seq, data)
+	} else {
+		_, writeErr = fmt.Fprintf(w, "%s\n", data)
+	}
+	return writeErr == nil
+}
+
+// idleTracker reports whether any activity (an entry delivered, or an
+// explicit touch) has happened within the last timeout, so a long-poll
+// handler can close a connection nobody's draining anymore.
+type idleTracker struct {
+	mu       sync.Mutex
+	lastSeen time.Time
+	timeout  time.Duration
+}
+
+func newIdleTracker(timeout time.Duration) *idleTracker {
+	return &idleTracker{lastSeen: time.Now(), timeout: timeout}
+}
+
+func (t *idleTracker) touch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastSeen = time.Now()
+}
+
+func (t *idleTracker) expired() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.lastSeen) > t.timeout
+}
@@ -0,0 +1,210 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package hub
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ScanOutcome classifies why ScanMonitor decided a project version's scan
+// had reached a terminal state.
+type ScanOutcome int
+
+const (
+	ScanOutcomeComplete ScanOutcome = iota
+	ScanOutcomeError
+	ScanOutcomeCancelled
+)
+
+func (o ScanOutcome) String() string {
+	switch o {
+	case ScanOutcomeComplete:
+		return "complete"
+	case ScanOutcomeError:
+		return "error"
+	case ScanOutcomeCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	scanPollMinInterval = 5 * time.Second
+	scanPollMaxInterval = 5 * time.Minute
+)
+
+// FetchVersion retrieves the current state of a project version. It's
+// satisfied by a method on a logged-in hub client, e.g. a HubFetcher.
+type FetchVersion func(projectName string, versionName string) (*Version, error)
+
+// ScanComplete is delivered on ScanMonitor's Done channel once a watched
+// project version's scan has reached a terminal state.
+type ScanComplete struct {
+	ProjectName string
+	VersionName string
+	Outcome     ScanOutcome
+	Version     Version
+}
+
+type watchedVersion struct {
+	projectName string
+	versionName string
+	nextPoll    time.Time
+	interval    time.Duration
+}
+
+// ScanMonitor polls the hub for the state of in-flight scans, backing off
+// exponentially per project version (capped at scanPollMaxInterval)
+// instead of polling every watched version on one fixed interval: a scan
+// that's going to take an hour shouldn't get polled every 5 seconds for
+// the entire hour, and a scan that finishes quickly shouldn't have to
+// wait out everyone else's interval.
+type ScanMonitor struct {
+	fetch FetchVersion
+	done  chan ScanComplete
+
+	mu       sync.Mutex
+	watching map[string]*watchedVersion
+}
+
+// NewScanMonitor returns a ScanMonitor that retrieves version state with
+// fetch. Call Watch to start tracking a version, and Run to drive polling.
+func NewScanMonitor(fetch FetchVersion) *ScanMonitor {
+	return &ScanMonitor{
+		fetch:    fetch,
+		done:     make(chan ScanComplete, 64),
+		watching: make(map[string]*watchedVersion),
+	}
+}
+
+// Done delivers a ScanComplete event once a watched version's scan
+// reaches a terminal state. The version is no longer watched afterward.
+func (m *ScanMonitor) Done() <-chan ScanComplete {
+	return m.done
+}
+
+// Watch starts tracking projectName/versionName's scan progress, polling
+// at scanPollMinInterval until it backs off. A version already being
+// watched is left alone. Call it right after submitting a scan to the Hub
+// for that project version, so Done() eventually reports its outcome;
+// pair with RunWebhookNotifier (or a custom Done() consumer) to push that
+// outcome on to the perceiver.
+func (m *ScanMonitor) Watch(projectName string, versionName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := watchKey(projectName, versionName)
+	if _, ok := m.watching[key]; ok {
+		return
+	}
+	m.watching[key] = &watchedVersion{
+		projectName: projectName,
+		versionName: versionName,
+		nextPoll:    time.Now(),
+		interval:    scanPollMinInterval,
+	}
+}
+
+// Run polls every watched version whose backoff has elapsed, until stopCh
+// is closed.
+func (m *ScanMonitor) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(scanPollMinInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			m.pollDue()
+		}
+	}
+}
+
+func (m *ScanMonitor) pollDue() {
+	now := time.Now()
+	m.mu.Lock()
+	due := make([]*watchedVersion, 0)
+	for _, w := range m.watching {
+		if !now.Before(w.nextPoll) {
+			due = append(due, w)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, w := range due {
+		version, err := m.fetch(w.projectName, w.versionName)
+		if err != nil {
+			log.Errorf("scan monitor: unable to fetch %s/%s: %s", w.projectName, w.versionName, err.Error())
+			m.reschedule(w)
+			continue
+		}
+		if !version.IsImageScanDone() {
+			m.reschedule(w)
+			continue
+		}
+		m.mu.Lock()
+		delete(m.watching, watchKey(w.projectName, w.versionName))
+		m.mu.Unlock()
+		m.done <- ScanComplete{
+			ProjectName: w.projectName,
+			VersionName: w.versionName,
+			Outcome:     classifyOutcome(*version),
+			Version:     *version,
+		}
+	}
+}
+
+func (m *ScanMonitor) reschedule(w *watchedVersion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.interval *= 2
+	if w.interval > scanPollMaxInterval {
+		w.interval = scanPollMaxInterval
+	}
+	w.nextPoll = time.Now().Add(w.interval)
+}
+
+// classifyOutcome assumes version.IsImageScanDone() is already true, and
+// picks the most severe outcome across its scan summaries: any CANCELLED
+// summary makes the whole version cancelled, any ERROR_* makes it an
+// error, and otherwise it completed cleanly.
+func classifyOutcome(version Version) ScanOutcome {
+	outcome := ScanOutcomeComplete
+	for _, codeLocation := range version.CodeLocations {
+		for _, scanSummary := range codeLocation.ScanSummaries {
+			switch scanSummary.Status {
+			case "CANCELLED":
+				return ScanOutcomeCancelled
+			case "ERROR", "ERROR_BUILDING_BOM", "ERROR_MATCHING", "ERROR_SAVING_SCAN_DATA", "ERROR_SCANNING":
+				outcome = ScanOutcomeError
+			}
+		}
+	}
+	return outcome
+}
+
+func watchKey(projectName string, versionName string) string {
+	return projectName + "/" + versionName
+}
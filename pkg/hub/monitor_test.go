@@ -0,0 +1,114 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package hub
+
+import "testing"
+
+func completeVersion(statuses ...string) Version {
+	summaries := make([]ScanSummary, len(statuses))
+	for i, status := range statuses {
+		summaries[i] = ScanSummary{Status: status}
+	}
+	return Version{CodeLocations: []CodeLocation{{ScanSummaries: summaries}}}
+}
+
+func TestClassifyOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		version Version
+		want    ScanOutcome
+	}{
+		{"all complete", completeVersion("COMPLETE", "COMPLETE"), ScanOutcomeComplete},
+		{"any cancelled wins", completeVersion("COMPLETE", "CANCELLED"), ScanOutcomeCancelled},
+		{"any error wins over complete", completeVersion("COMPLETE", "ERROR_SCANNING"), ScanOutcomeError},
+		{"cancelled outranks error", completeVersion("ERROR", "CANCELLED"), ScanOutcomeCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyOutcome(tt.version); got != tt.want {
+				t.Errorf("classifyOutcome(%v) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestScanMonitorPollDueDeliversDoneAndStopsWatching verifies that once a
+// watched version's scan is done, pollDue reports it on Done() and removes
+// it from the watch set instead of continuing to poll it.
+func TestScanMonitorPollDueDeliversDoneAndStopsWatching(t *testing.T) {
+	version := completeVersion("COMPLETE")
+	fetchCalls := 0
+	monitor := NewScanMonitor(func(projectName string, versionName string) (*Version, error) {
+		fetchCalls++
+		return &version, nil
+	})
+
+	monitor.Watch("myproject", "1.0")
+	monitor.pollDue()
+
+	select {
+	case scanComplete := <-monitor.Done():
+		if scanComplete.ProjectName != "myproject" || scanComplete.VersionName != "1.0" {
+			t.Errorf("unexpected ScanComplete: %+v", scanComplete)
+		}
+		if scanComplete.Outcome != ScanOutcomeComplete {
+			t.Errorf("expected ScanOutcomeComplete, got %v", scanComplete.Outcome)
+		}
+	default:
+		t.Fatal("expected a ScanComplete to be delivered")
+	}
+
+	if fetchCalls != 1 {
+		t.Errorf("expected exactly 1 fetch call, got %d", fetchCalls)
+	}
+	if _, stillWatching := monitor.watching[watchKey("myproject", "1.0")]; stillWatching {
+		t.Error("expected the version to no longer be watched once its scan completed")
+	}
+}
+
+// TestScanMonitorPollDueReschedulesAnUnfinishedScan verifies a version
+// whose scan hasn't finished yet stays watched with its next poll pushed
+// back, instead of being reported done.
+func TestScanMonitorPollDueReschedulesAnUnfinishedScan(t *testing.T) {
+	version := Version{}
+	monitor := NewScanMonitor(func(projectName string, versionName string) (*Version, error) {
+		return &version, nil
+	})
+
+	monitor.Watch("myproject", "1.0")
+	originalInterval := monitor.watching[watchKey("myproject", "1.0")].interval
+	monitor.pollDue()
+
+	select {
+	case scanComplete := <-monitor.Done():
+		t.Fatalf("expected no ScanComplete for an unfinished scan, got %+v", scanComplete)
+	default:
+	}
+
+	watched, stillWatching := monitor.watching[watchKey("myproject", "1.0")]
+	if !stillWatching {
+		t.Fatal("expected the version to remain watched")
+	}
+	if watched.interval <= originalInterval {
+		t.Errorf("expected the poll interval to back off, stayed at %v", watched.interval)
+	}
+}
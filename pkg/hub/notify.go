@@ -0,0 +1,86 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scanCompleteNotification is the payload POSTed to the perceiver
+// scan-complete webhook. It only carries what ScanMonitor itself knows
+// about a finished scan -- the Hub project/version and outcome -- since
+// mapping a project version back to the pods that reference it lives in
+// pkg/core, not here.
+type scanCompleteNotification struct {
+	ProjectName string      `json:"projectName"`
+	VersionName string      `json:"versionName"`
+	Outcome     ScanOutcome `json:"outcome"`
+}
+
+// RunWebhookNotifier drains Done() and POSTs each ScanComplete to
+// webhookURL as it arrives, until stopCh is closed. This is what turns a
+// watched scan's completion into the push that replaces polling
+// ScanResultsPath -- without a consumer draining Done(), watched scans
+// finish but nothing is ever told.
+func (m *ScanMonitor) RunWebhookNotifier(client *http.Client, webhookURL string, stopCh <-chan struct{}) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for {
+		select {
+		case <-stopCh:
+			return
+		case scan, ok := <-m.Done():
+			if !ok {
+				return
+			}
+			if err := postScanComplete(client, webhookURL, scan); err != nil {
+				log.Errorf("scan monitor: unable to notify %s of completed scan %s/%s: %s", webhookURL, scan.ProjectName, scan.VersionName, err.Error())
+			}
+		}
+	}
+}
+
+func postScanComplete(client *http.Client, webhookURL string, scan ScanComplete) error {
+	body, err := json.Marshal(scanCompleteNotification{
+		ProjectName: scan.ProjectName,
+		VersionName: scan.VersionName,
+		Outcome:     scan.Outcome,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to serialize scan-complete notification: %v", err)
+	}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
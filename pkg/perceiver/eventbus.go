@@ -0,0 +1,68 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package perceiver
+
+import (
+	"fmt"
+	"time"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/eventbus"
+	log "github.com/sirupsen/logrus"
+)
+
+// eventBusBufferSize bounds both the replay ring buffer (for clients
+// reconnecting with a `since` cursor) and each subscriber's backlog.
+const eventBusBufferSize = 256
+
+// EventBus fans out perceiver's activity to both logrus and /events
+// subscribers. It's a thin typed wrapper around pkg/eventbus.Bus, the
+// ring-buffered pub/sub logic shared with pkg/core's domain event stream.
+type EventBus struct {
+	bus *eventbus.Bus
+}
+
+// NewEventBus returns an empty EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{bus: eventbus.New(eventBusBufferSize, eventbus.Hooks{})}
+}
+
+// Infof logs an info-level activity event through logrus, and publishes
+// it to /events subscribers.
+func (b *EventBus) Infof(format string, args ...interface{}) {
+	log.Infof(format, args...)
+	b.publish(EventInfo, format, args...)
+}
+
+// Errorf logs an error-level activity event through logrus, and publishes
+// it to /events subscribers.
+func (b *EventBus) Errorf(format string, args ...interface{}) {
+	log.Errorf(format, args...)
+	b.publish(EventError, format, args...)
+}
+
+func (b *EventBus) publish(kind EventKind, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	now := time.Now()
+	b.bus.Publish(func(seq uint64) interface{} {
+		return Event{Seq: seq, Kind: kind, Message: message, Timestamp: now}
+	})
+}
@@ -0,0 +1,47 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package perceiver holds the activity event stream for the kube-perceiver
+// binary: an /events endpoint exposing the same info/error activity that
+// used to only go to logrus, as either server-sent events or NDJSON. It's
+// a separate, much simpler bus from pkg/core's -- that one streams core's
+// domain events (pods, images, scans); this one streams perceiver's own
+// operational log.
+package perceiver
+
+import "time"
+
+// EventKind classifies an activity event, both for display and for the
+// /events endpoint's ?filter=kind=<kind> query parameter.
+type EventKind string
+
+const (
+	EventInfo  EventKind = "info"
+	EventError EventKind = "error"
+)
+
+// Event is one entry in perceiver's activity stream.
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Kind      EventKind `json:"kind"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
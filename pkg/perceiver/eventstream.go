@@ -0,0 +1,69 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package perceiver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"bitbucket.org/bdsengineering/perceptor/pkg/eventbus"
+)
+
+// NewEventStreamHandler returns the GET /events handler: it streams
+// activity events published to bus as they happen, replaying anything
+// still in the ring buffer newer than the `since` query parameter first.
+// The framing is negotiated from the Accept header -- "text/event-stream"
+// gets SSE, anything else gets newline-delimited JSON. `?filter=kind=error`
+// restricts the stream to events of that kind. This is the pkg/eventbus
+// generic stream handler, with no idle timeout (unlike core's /events,
+// perceiver's isn't expected to sit open on a long-poll subscriber) and a
+// kind filter built from the request's query string.
+func NewEventStreamHandler(bus *EventBus) http.Handler {
+	return eventbus.NewHandler(bus.bus, 0, buildKindFilter)
+}
+
+func buildKindFilter(r *http.Request) (func(interface{}) bool, error) {
+	kindFilter, err := parseKindFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return nil, err
+	}
+	if kindFilter == "" {
+		return nil, nil
+	}
+	return func(event interface{}) bool {
+		return event.(Event).Kind == kindFilter
+	}, nil
+}
+
+// parseKindFilter parses the `filter` query parameter, which is expected
+// to look like "kind=error". An empty filter matches every event.
+func parseKindFilter(filter string) (EventKind, error) {
+	if filter == "" {
+		return "", nil
+	}
+	parts := strings.SplitN(filter, "=", 2)
+	if len(parts) != 2 || parts[0] != "kind" {
+		return "", fmt.Errorf("unsupported filter %q: expected kind=<kind>", filter)
+	}
+	return EventKind(parts[1]), nil
+}
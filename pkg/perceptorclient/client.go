@@ -0,0 +1,209 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package perceptorclient is a retrying, queueing HTTP client for talking
+// to perceptor's pod API. It replaces the inline http.Post/Put/Do calls
+// cmd/kube-perceiver used to make directly: every mutating call is
+// enqueued onto a workqueue and returns immediately, so a slow or
+// briefly-unavailable perceptor never blocks the caller, and a failed
+// request is retried with exponential backoff instead of just logged and
+// dropped; one that still fails is put back on the queue after a
+// rate-limited delay. The queue has no size limit.
+package perceptorclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	api "bitbucket.org/bdsengineering/perceptor/pkg/api"
+	common "bitbucket.org/bdsengineering/perceptor/pkg/common"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// operation labels an outbound request for logging and metrics.
+type operation string
+
+const (
+	opAddPod         operation = "add_pod"
+	opUpdatePod      operation = "update_pod"
+	opDeletePod      operation = "delete_pod"
+	opPutAllPods     operation = "put_all_pods"
+	opGetScanResults operation = "get_scan_results"
+)
+
+// outboundRequest is one item on Client's outbound queue.
+type outboundRequest struct {
+	op operation
+	do func(*http.Client) (*http.Response, error)
+}
+
+// Client is a retrying, queueing HTTP client for perceptor's pod API. See
+// the package doc for the rationale behind queueing.
+type Client struct {
+	httpClient *http.Client
+
+	podURL         string
+	allPodsURL     string
+	scanResultsURL string
+
+	queue workqueue.RateLimitingInterface
+
+	metrics *clientMetrics
+}
+
+// NewClient returns a Client targeting perceptor at baseURL (e.g.
+// "http://perceptor:3001"), and starts workerCount background workers
+// draining its outbound queue. Call Stop to shut them down.
+func NewClient(baseURL string, workerCount int) *Client {
+	c := &Client{
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConns:        50,
+				MaxIdleConnsPerHost: 50,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		podURL:         fmt.Sprintf("%s/%s", baseURL, api.PodPath),
+		allPodsURL:     fmt.Sprintf("%s/%s", baseURL, api.AllPodsPath),
+		scanResultsURL: fmt.Sprintf("%s/%s", baseURL, api.ScanResultsPath),
+		queue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		metrics:        newClientMetrics(),
+	}
+	for i := 0; i < workerCount; i++ {
+		go c.worker()
+	}
+	return c
+}
+
+// Stop shuts down the outbound queue. Workers exit once it drains.
+func (c *Client) Stop() {
+	c.queue.ShutDown()
+}
+
+// AddPod enqueues a POST of pod to perceptor's pod endpoint.
+func (c *Client) AddPod(pod common.Pod) {
+	c.enqueue(opAddPod, func(client *http.Client) (*http.Response, error) {
+		return postJSON(client, "POST", c.podURL, pod)
+	})
+}
+
+// UpdatePod enqueues a PUT of pod to perceptor's pod endpoint.
+func (c *Client) UpdatePod(pod common.Pod) {
+	c.enqueue(opUpdatePod, func(client *http.Client) (*http.Response, error) {
+		return postJSON(client, "PUT", c.podURL, pod)
+	})
+}
+
+// DeletePod enqueues a DELETE of qualifiedName to perceptor's pod endpoint.
+func (c *Client) DeletePod(qualifiedName string) {
+	c.enqueue(opDeletePod, func(client *http.Client) (*http.Response, error) {
+		return postJSON(client, "DELETE", c.podURL, struct {
+			QualifiedName string `json:"qualifiedName"`
+		}{qualifiedName})
+	})
+}
+
+// PutAllPods enqueues a POST of every pod in pods to perceptor's all-pods
+// endpoint.
+func (c *Client) PutAllPods(pods []common.Pod) {
+	c.enqueue(opPutAllPods, func(client *http.Client) (*http.Response, error) {
+		return postJSON(client, "POST", c.allPodsURL, api.NewAllPods(pods))
+	})
+}
+
+func (c *Client) enqueue(op operation, do func(*http.Client) (*http.Response, error)) {
+	c.queue.Add(&outboundRequest{op: op, do: do})
+	c.metrics.queueDepth.Set(float64(c.queue.Len()))
+}
+
+func (c *Client) worker() {
+	for {
+		item, shutdown := c.queue.Get()
+		if shutdown {
+			return
+		}
+		req := item.(*outboundRequest)
+		c.metrics.queueDepth.Set(float64(c.queue.Len()))
+
+		resp, err := doWithRetry(
+			func() (*http.Response, error) { return req.do(c.httpClient) },
+			func() { c.metrics.requestsRetried.With(prometheus.Labels{"operation": string(req.op)}).Inc() },
+		)
+		if err != nil {
+			log.Errorf("perceptorclient: %s failed after retrying: %s", req.op, err.Error())
+			c.metrics.requestsFailed.With(prometheus.Labels{"operation": string(req.op)}).Inc()
+			c.queue.Done(req)
+			c.queue.AddRateLimited(req)
+			continue
+		}
+		resp.Body.Close()
+		c.metrics.requestsSucceeded.With(prometheus.Labels{"operation": string(req.op)}).Inc()
+		c.queue.Forget(req)
+		c.queue.Done(req)
+	}
+}
+
+// GetScanResults fetches perceptor's current scan results, retrying with
+// exponential backoff on failure. Unlike the methods above, this is
+// synchronous rather than queued: a caller needs the result back, so
+// there's nothing useful to hand off to a background worker.
+func (c *Client) GetScanResults() (*api.ScanResults, error) {
+	resp, err := doWithRetry(
+		func() (*http.Response, error) { return c.httpClient.Get(c.scanResultsURL) },
+		func() { c.metrics.requestsRetried.With(prometheus.Labels{"operation": string(opGetScanResults)}).Inc() },
+	)
+	if err != nil {
+		c.metrics.requestsFailed.With(prometheus.Labels{"operation": string(opGetScanResults)}).Inc()
+		return nil, fmt.Errorf("unable to GET %s: %s", c.scanResultsURL, err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body from %s: %s", c.scanResultsURL, err.Error())
+	}
+	var scanResults api.ScanResults
+	if err := json.Unmarshal(bodyBytes, &scanResults); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal scan results from %s: %s", c.scanResultsURL, err.Error())
+	}
+	c.metrics.requestsSucceeded.With(prometheus.Labels{"operation": string(opGetScanResults)}).Inc()
+	return &scanResults, nil
+}
+
+func postJSON(client *http.Client, method string, url string, body interface{}) (*http.Response, error) {
+	jsonBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize request body: %s", err.Error())
+	}
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s request for %s: %s", method, url, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return client.Do(req)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package perceptorclient
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type clientMetrics struct {
+	requestsSucceeded *prometheus.CounterVec
+	requestsFailed    *prometheus.CounterVec
+	requestsRetried   *prometheus.CounterVec
+	queueDepth        prometheus.Gauge
+}
+
+func newClientMetrics() *clientMetrics {
+	m := &clientMetrics{}
+	m.requestsSucceeded = registerCounterVec(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "perceiver",
+		Subsystem: "client",
+		Name:      "requests_succeeded_total",
+		Help:      "number of requests to perceptor that eventually succeeded",
+	}, []string{"operation"}))
+	m.requestsFailed = registerCounterVec(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "perceiver",
+		Subsystem: "client",
+		Name:      "requests_failed_total",
+		Help:      "number of requests to perceptor that failed even after retrying",
+	}, []string{"operation"}))
+	m.requestsRetried = registerCounterVec(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "perceiver",
+		Subsystem: "client",
+		Name:      "requests_retried_total",
+		Help:      "number of retry attempts issued against perceptor",
+	}, []string{"operation"}))
+	m.queueDepth = registerGauge(prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "perceiver",
+		Subsystem: "client",
+		Name:      "queue_depth",
+		Help:      "number of outbound requests waiting to be sent to perceptor",
+	}))
+	return m
+}
@@ -0,0 +1,54 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package perceptorclient
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// registerCounterVec registers c with the default Prometheus registry,
+// unless a collector with the same fully-qualified name is already
+// registered -- in which case the existing one is reused instead. Without
+// this, a second call to newClientMetrics in the same process (e.g. from a
+// test that builds more than one Client) would hit
+// prometheus.MustRegister's panic on duplicate registration.
+func registerCounterVec(c *prometheus.CounterVec) *prometheus.CounterVec {
+	if err := prometheus.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(*prometheus.CounterVec)
+		}
+		log.Errorf("unable to register metric: %s", err.Error())
+	}
+	return c
+}
+
+// registerGauge is registerCounterVec for a prometheus.Gauge.
+func registerGauge(g prometheus.Gauge) prometheus.Gauge {
+	if err := prometheus.Register(g); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(prometheus.Gauge)
+		}
+		log.Errorf("unable to register metric: %s", err.Error())
+	}
+	return g
+}
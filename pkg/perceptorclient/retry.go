@@ -0,0 +1,75 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package perceptorclient
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	maxRetries     = 5
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// doWithRetry issues do, retrying with exponential backoff and jitter on a
+// transport error or a 5xx response, up to maxRetries times. A 4xx
+// response is a permanent client error -- retrying it would just get the
+// same rejection again -- so it's returned as a failure immediately,
+// without consuming a retry. onRetry, if non-nil, is called once per retry
+// (not on the initial attempt) so the caller can record a metric.
+func doWithRetry(do func() (*http.Response, error), onRetry func()) (*http.Response, error) {
+	backoff := initialBackoff
+	var lastErr error
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		resp, err := do()
+		if err == nil {
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return resp, nil
+			}
+			if resp.StatusCode < 500 {
+				resp.Body.Close()
+				return nil, fmt.Errorf("received status code %d", resp.StatusCode)
+			}
+			lastErr = fmt.Errorf("received status code %d", resp.StatusCode)
+			resp.Body.Close()
+		} else {
+			lastErr = err
+		}
+		if attempt == maxRetries {
+			break
+		}
+		if onRetry != nil {
+			onRetry()
+		}
+		time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff)/2+1)))
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	return nil, lastErr
+}
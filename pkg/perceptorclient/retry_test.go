@@ -0,0 +1,108 @@
+/*
+Copyright (C) 2018 Black Duck Software, Inc.
+
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements. See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership. The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied. See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package perceptorclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func statusResponse(code int) *http.Response {
+	return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader(""))}
+}
+
+func TestDoWithRetrySucceedsOn2xx(t *testing.T) {
+	calls := 0
+	resp, err := doWithRetry(func() (*http.Response, error) {
+		calls++
+		return statusResponse(200), nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if calls != 1 {
+		t.Errorf("expected exactly 1 call, got %d", calls)
+	}
+}
+
+func TestDoWithRetryFailsImmediatelyOn4xx(t *testing.T) {
+	calls := 0
+	retries := 0
+	_, err := doWithRetry(func() (*http.Response, error) {
+		calls++
+		return statusResponse(404), nil
+	}, func() { retries++ })
+	if err == nil {
+		t.Fatal("expected an error for a 404 response")
+	}
+	if calls != 1 {
+		t.Errorf("expected a 4xx to fail without retrying, got %d calls", calls)
+	}
+	if retries != 0 {
+		t.Errorf("expected no retries for a 4xx, got %d", retries)
+	}
+}
+
+func TestDoWithRetryRetriesOn5xxThenSucceeds(t *testing.T) {
+	calls := 0
+	retries := 0
+	resp, err := doWithRetry(func() (*http.Response, error) {
+		calls++
+		if calls < 3 {
+			return statusResponse(503), nil
+		}
+		return statusResponse(200), nil
+	}, func() { retries++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected eventual status 200, got %d", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls (2 failures + 1 success), got %d", calls)
+	}
+	if retries != 2 {
+		t.Errorf("expected 2 retries, got %d", retries)
+	}
+}
+
+func TestDoWithRetryGivesUpAfterMaxRetriesOnTransportError(t *testing.T) {
+	calls := 0
+	transportErr := errors.New("connection reset")
+	_, err := doWithRetry(func() (*http.Response, error) {
+		calls++
+		return nil, transportErr
+	}, nil)
+	if err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if calls != maxRetries+1 {
+		t.Errorf("expected %d calls (initial attempt + %d retries), got %d", maxRetries+1, maxRetries, calls)
+	}
+}
@@ -0,0 +1,59 @@
+package registries
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Registry holds the connection details perceptor needs in order to
+// authenticate against a single registry host when resolving and pulling
+// images for scanning.
+type Registry struct {
+	// Host is the registry hostname, e.g. "docker.io" or "myregistry:5000".
+	// It is matched against the host portion of an image reference.
+	Host string `yaml:"host"`
+	// Username/Password are used for basic auth against the registry.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// DockerConfigPath, if set, points at a docker config.json style file
+	// (as produced by `docker login`) to use instead of Username/Password.
+	DockerConfigPath string `yaml:"dockerConfigPath"`
+	// Token, if set, is used as a bearer token instead of basic auth.
+	Token string `yaml:"token"`
+	// Insecure allows pulling over plain HTTP or with an unverified TLS cert.
+	Insecure bool `yaml:"insecure"`
+}
+
+// Config is the top-level `pkg/registries` configuration: the set of
+// registries perceptor is willing to authenticate against when resolving
+// image references to manifests and pulling blobs.
+type Config struct {
+	Registries []*Registry `yaml:"registries"`
+}
+
+// Load reads a registries config file from disk.
+func Load(path string) (*Config, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registries config %s: %v", path, err)
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(bytes, config); err != nil {
+		return nil, fmt.Errorf("unable to parse registries config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Find returns the Registry configured for the given host, or nil if
+// the host has no explicit configuration (in which case anonymous,
+// unauthenticated pulls should be attempted).
+func (c *Config) Find(host string) *Registry {
+	for _, r := range c.Registries {
+		if r.Host == host {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package trust
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RequirementType is the kind of check a Scope's requirement performs,
+// mirroring containers/image's policy.json vocabulary.
+type RequirementType string
+
+const (
+	// InsecureAcceptAnything lets any image through unverified.
+	InsecureAcceptAnything RequirementType = "insecureAcceptAnything"
+	// Reject refuses every image matching the scope.
+	Reject RequirementType = "reject"
+	// SignedBy requires a valid signature from the given GPG/cosign key.
+	SignedBy RequirementType = "signedBy"
+	// SigstoreSigned requires a valid sigstore (cosign) signature.
+	SigstoreSigned RequirementType = "sigstoreSigned"
+)
+
+// Scope scopes a Requirement to a registry, optionally narrowed to a
+// repository and tag glob, e.g. "docker.io/myorg/*:release-*".
+type Scope struct {
+	Registry   string          `yaml:"registry"`
+	Repository string          `yaml:"repository,omitempty"`
+	Tag        string          `yaml:"tag,omitempty"`
+	Type       RequirementType `yaml:"type"`
+	KeyPath    string          `yaml:"keyPath,omitempty"`
+}
+
+// Policy is the effective set of scoped requirements consulted before an
+// image is allowed to transition into the scan queue. It is modeled on
+// containers/image's policy.json trust policy format.
+type Policy struct {
+	Default  []Scope            `yaml:"default"`
+	Registry map[string][]Scope `yaml:"registry"`
+}
+
+// Load reads a policy.json/policy.yaml style trust policy file from disk.
+func Load(path string) (*Policy, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read trust policy %s: %v", path, err)
+	}
+	policy := &Policy{}
+	if err := yaml.Unmarshal(bytes, policy); err != nil {
+		return nil, fmt.Errorf("unable to parse trust policy %s: %v", path, err)
+	}
+	return policy, nil
+}
+
+// scopesFor returns the requirement list that applies to ref's registry,
+// falling back to the policy default if the registry has no entry.
+func (p *Policy) scopesFor(registry string) []Scope {
+	if scopes, ok := p.Registry[registry]; ok {
+		return scopes
+	}
+	return p.Default
+}
+
+// EffectivePolicy returns the scopes that would be consulted for ref, most
+// specific first, for use by a "trust show" style audit endpoint. A scope
+// narrowed by both repository and tag is more specific than one narrowed
+// by only one of them, which is more specific than a bare registry scope;
+// equally specific scopes keep the order the policy lists them in.
+func (p *Policy) EffectivePolicy(ref string) []Scope {
+	registry, repository, tag := splitRef(ref)
+	matches := []Scope{}
+	for _, scope := range p.scopesFor(registry) {
+		if scopeMatches(scope, repository, tag) {
+			matches = append(matches, scope)
+		}
+	}
+	specificity := func(scope Scope) int {
+		n := 0
+		if scope.Repository != "" {
+			n++
+		}
+		if scope.Tag != "" {
+			n++
+		}
+		return n
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return specificity(matches[i]) > specificity(matches[j])
+	})
+	return matches
+}
+
+func scopeMatches(scope Scope, repository string, tag string) bool {
+	if scope.Repository != "" {
+		if ok, _ := path.Match(scope.Repository, repository); !ok {
+			return false
+		}
+	}
+	if scope.Tag != "" {
+		if ok, _ := path.Match(scope.Tag, tag); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func splitRef(ref string) (registry string, repository string, tag string) {
+	registry = ref
+	repository = ref
+	tag = "latest"
+	if idx := strings.Index(ref, "/"); idx >= 0 {
+		registry = ref[:idx]
+		repository = ref[idx+1:]
+	}
+	if idx := strings.LastIndex(repository, ":"); idx >= 0 {
+		tag = repository[idx+1:]
+		repository = repository[:idx]
+	}
+	return registry, repository, tag
+}
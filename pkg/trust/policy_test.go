@@ -0,0 +1,133 @@
+package trust
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	signatureErr := errors.New("boom")
+
+	tests := []struct {
+		name              string
+		policy            Policy
+		ref               string
+		hasValidSignature func(Scope) (bool, error)
+		wantAllowed       bool
+		wantErr           bool
+	}{
+		{
+			name:        "no matching scope rejects by default",
+			policy:      Policy{},
+			ref:         "docker.io/library/busybox:latest",
+			wantAllowed: false,
+		},
+		{
+			name: "insecureAcceptAnything admits",
+			policy: Policy{
+				Default: []Scope{{Type: InsecureAcceptAnything}},
+			},
+			ref:         "docker.io/library/busybox:latest",
+			wantAllowed: true,
+		},
+		{
+			name: "reject refuses",
+			policy: Policy{
+				Default: []Scope{{Type: Reject}},
+			},
+			ref:         "docker.io/library/busybox:latest",
+			wantAllowed: false,
+		},
+		{
+			name: "signedBy rejects when the signature doesn't verify",
+			policy: Policy{
+				Default: []Scope{{Type: SignedBy, KeyPath: "/keys/trusted.gpg"}},
+			},
+			ref:               "docker.io/library/busybox:latest",
+			hasValidSignature: func(Scope) (bool, error) { return false, nil },
+			wantAllowed:       false,
+		},
+		{
+			name: "signedBy admits when the signature verifies",
+			policy: Policy{
+				Default: []Scope{{Type: SignedBy, KeyPath: "/keys/trusted.gpg"}},
+			},
+			ref:               "docker.io/library/busybox:latest",
+			hasValidSignature: func(Scope) (bool, error) { return true, nil },
+			wantAllowed:       true,
+		},
+		{
+			name: "signedBy propagates a verification error",
+			policy: Policy{
+				Default: []Scope{{Type: SignedBy, KeyPath: "/keys/trusted.gpg"}},
+			},
+			ref:               "docker.io/library/busybox:latest",
+			hasValidSignature: func(Scope) (bool, error) { return false, signatureErr },
+			wantErr:           true,
+		},
+		{
+			name: "registry-specific scope wins over default",
+			policy: Policy{
+				Default:  []Scope{{Type: Reject}},
+				Registry: map[string][]Scope{"docker.io": {{Type: InsecureAcceptAnything}}},
+			},
+			ref:         "docker.io/library/busybox:latest",
+			wantAllowed: true,
+		},
+		{
+			name: "repository glob narrows a registry scope",
+			policy: Policy{
+				Registry: map[string][]Scope{"docker.io": {
+					{Type: InsecureAcceptAnything, Repository: "library/*"},
+					{Type: Reject},
+				}},
+			},
+			ref:         "docker.io/other/busybox:latest",
+			wantAllowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := tt.policy.Evaluate(tt.ref, tt.hasValidSignature)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got verdict %+v", verdict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if verdict.Allowed != tt.wantAllowed {
+				t.Errorf("Evaluate(%q) = %+v, want Allowed=%v", tt.ref, verdict, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestPolicyEffectivePolicyOrdering(t *testing.T) {
+	policy := Policy{
+		Registry: map[string][]Scope{"docker.io": {
+			{Type: SignedBy, Repository: "library/busybox", Tag: "release-*"},
+			{Type: Reject, Repository: "library/busybox"},
+			{Type: InsecureAcceptAnything},
+		}},
+	}
+
+	scopes := policy.EffectivePolicy("docker.io/library/busybox:release-1.0")
+	if len(scopes) != 3 {
+		t.Fatalf("expected 3 matching scopes, got %d: %+v", len(scopes), scopes)
+	}
+	if scopes[0].Type != SignedBy {
+		t.Errorf("expected most-specific scope (tag glob) first, got %+v", scopes[0])
+	}
+
+	scopes = policy.EffectivePolicy("docker.io/library/busybox:latest")
+	if len(scopes) != 2 {
+		t.Fatalf("expected 2 matching scopes for a non-release tag, got %d: %+v", len(scopes), scopes)
+	}
+	if scopes[0].Type != Reject {
+		t.Errorf("expected the repository-scoped reject first, got %+v", scopes[0])
+	}
+}
@@ -0,0 +1,40 @@
+package trust
+
+import "fmt"
+
+// Verdict is the outcome of evaluating an image reference against a
+// Policy: whether it may proceed to the scan queue, and why.
+type Verdict struct {
+	Allowed bool
+	Reason  string
+}
+
+// Evaluate walks the scopes that apply to ref (most specific first) and
+// returns the verdict of the first one that applies. A policy with no
+// matching scope rejects by default, the same fail-closed behavior
+// containers/image uses when a reference isn't covered by policy.json.
+func (p *Policy) Evaluate(ref string, hasValidSignature func(Scope) (bool, error)) (Verdict, error) {
+	scopes := p.EffectivePolicy(ref)
+	if len(scopes) == 0 {
+		return Verdict{Allowed: false, Reason: "no policy scope matched this reference"}, nil
+	}
+
+	scope := scopes[0]
+	switch scope.Type {
+	case InsecureAcceptAnything:
+		return Verdict{Allowed: true, Reason: "insecureAcceptAnything"}, nil
+	case Reject:
+		return Verdict{Allowed: false, Reason: "rejected by policy scope"}, nil
+	case SignedBy, SigstoreSigned:
+		ok, err := hasValidSignature(scope)
+		if err != nil {
+			return Verdict{}, fmt.Errorf("unable to verify signature for %s: %v", ref, err)
+		}
+		if !ok {
+			return Verdict{Allowed: false, Reason: fmt.Sprintf("no valid %s signature", scope.Type)}, nil
+		}
+		return Verdict{Allowed: true, Reason: string(scope.Type)}, nil
+	default:
+		return Verdict{Allowed: false, Reason: fmt.Sprintf("unknown requirement type %q", scope.Type)}, nil
+	}
+}